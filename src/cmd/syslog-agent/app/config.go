@@ -1,6 +1,7 @@
 package app
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
@@ -30,6 +31,44 @@ type Cache struct {
 	Blacklist       blacklist.BlacklistRanges `env:"BLACKLISTED_SYSLOG_RANGES, report"`
 }
 
+// DrainSpool stores the configuration of the on-disk spool for batching
+// HTTP drains. The spool is disabled if Dir is empty.
+type DrainSpool struct {
+	Dir              string        `env:"DRAIN_SPOOL_DIR,                 report"`
+	MaxBytes         int64         `env:"DRAIN_SPOOL_MAX_BYTES,           report"`
+	MaxBytesPerDrain int64         `env:"DRAIN_SPOOL_MAX_BYTES_PER_DRAIN, report"`
+	GracePeriod      time.Duration `env:"DRAIN_SPOOL_GRACE_PERIOD,        report"`
+}
+
+// DrainCircuitBreaker stores the configuration of the circuit breaker of
+// every drain. The circuit breaker is disabled if Threshold is 0.
+type DrainCircuitBreaker struct {
+	Threshold     int           `env:"DRAIN_CIRCUIT_BREAKER_THRESHOLD,      report"`
+	ProbeInterval time.Duration `env:"DRAIN_CIRCUIT_BREAKER_PROBE_INTERVAL, report"`
+}
+
+// RedactionRule is a redaction rule configured by the operator.
+type RedactionRule struct {
+	Name        string `json:"name"`
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+}
+
+// RedactionRules holds the redaction rules configured by the operator.
+type RedactionRules struct {
+	Rules []RedactionRule
+}
+
+// UnmarshalEnv implements envstruct.Unmarshaller.
+// Example input:
+// [{"name":"password","pattern":"password=\\S+","replacement":"password=***"}]
+func (r *RedactionRules) UnmarshalEnv(v string) error {
+	if v == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(v), &r.Rules)
+}
+
 // Config holds the configuration for the syslog agent
 type Config struct {
 	UseRFC3339             bool          `env:"USE_RFC3339"`
@@ -38,16 +77,26 @@ type Config struct {
 	DrainCipherSuites      string        `env:"DRAIN_CIPHER_SUITES,    report"`
 	DrainTrustedCAFile     string        `env:"DRAIN_TRUSTED_CA_FILE,  report"`
 	DefaultDrainMetadata   bool          `env:"DEFAULT_DRAIN_METADATA, report"`
+	DrainCompression       string        `env:"DRAIN_COMPRESSION,      report"`
+	DrainRateLimit         int           `env:"DRAIN_RATE_LIMIT,       report"`
+	DrainRateLimitBurst    int           `env:"DRAIN_RATE_LIMIT_BURST, report"`
+	DrainHostnameTemplate  string        `env:"DRAIN_HOSTNAME_TEMPLATE, report"`
+	DrainAppNameTemplate   string        `env:"DRAIN_APPNAME_TEMPLATE,  report"`
 	IdleDrainTimeout       time.Duration `env:"IDLE_DRAIN_TIMEOUT,     report"`
 	WarnOnInvalidDrains    bool          `env:"WARN_ON_INVALID_DRAINS, report"`
 	LoggregatorIngressAddr string        `env:"LOGGREGATOR_AGENT_ADDR, report, required"`
 
-	GRPC          GRPC
-	Cache         Cache
-	MetricsServer config.MetricsServer
+	GRPC                GRPC
+	Cache               Cache
+	MetricsServer       config.MetricsServer
+	DrainSpool          DrainSpool
+	DrainCircuitBreaker DrainCircuitBreaker
+
+	DrainRedactionRules RedactionRules `env:"DRAIN_REDACTION_RULES, report"`
 
 	AggregateConnectionRefreshInterval time.Duration `env:"AGGREGATE_CONNECTION_REFRESH_INTERVAL, report"`
 	AggregateDrainURLs                 []string      `env:"AGGREGATE_DRAIN_URLS,                  report"`
+	AggregateDrainRedaction            string        `env:"AGGREGATE_DRAIN_REDACTION,             report"`
 }
 
 // LoadConfig will load the configuration for the syslog agent from the
@@ -64,6 +113,14 @@ func LoadConfig() Config {
 		GRPC: GRPC{
 			Port: 3458,
 		},
+		DrainSpool: DrainSpool{
+			MaxBytes:         1024 * 1024 * 1024,
+			MaxBytesPerDrain: 100 * 1024 * 1024,
+			GracePeriod:      time.Hour,
+		},
+		DrainCircuitBreaker: DrainCircuitBreaker{
+			ProbeInterval: 30 * time.Second,
+		},
 		AggregateConnectionRefreshInterval: 1 * time.Minute,
 		DefaultDrainMetadata:               true,
 	}
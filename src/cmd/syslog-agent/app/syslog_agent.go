@@ -8,6 +8,7 @@ import (
 	"net/http"
 	_ "net/http/pprof" //nolint:gosec
 	"os"
+	"slices"
 	"time"
 
 	gendiodes "code.cloudfoundry.org/go-diodes"
@@ -58,11 +59,26 @@ func NewSyslogAgent(
 	l *log.Logger,
 ) *SyslogAgent {
 	internalTlsConfig, externalTlsConfig := drainTLSConfig(cfg)
+	writerFactoryOpts := []syslog.WriterFactoryOption{
+		syslog.WithCircuitBreaker(cfg.DrainCircuitBreaker.Threshold, cfg.DrainCircuitBreaker.ProbeInterval),
+	}
+	if cfg.DrainSpool.Dir != "" {
+		spool, err := syslog.NewSpool(
+			cfg.DrainSpool.Dir,
+			cfg.DrainSpool.MaxBytes,
+			cfg.DrainSpool.MaxBytesPerDrain,
+			cfg.DrainSpool.GracePeriod,
+		)
+		if err != nil {
+			l.Panicf("failed to create drain spool: %s", err)
+		}
+		writerFactoryOpts = append(writerFactoryOpts, syslog.WithDrainSpool(spool))
+	}
 	writerFactory := syslog.NewWriterFactory(internalTlsConfig, externalTlsConfig, syslog.NetworkTimeoutConfig{
 		Keepalive:    10 * time.Second,
 		DialTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
-	}, m)
+	}, m, writerFactoryOpts...)
 	ingressTLSConfig, err := loggregator.NewIngressTLSConfig(
 		cfg.GRPC.CAFile,
 		cfg.GRPC.CertFile,
@@ -81,14 +97,36 @@ func NewSyslogAgent(
 		l.Panicf("failed to create log client for syslog connector: %q", err)
 	}
 
+	var redactionRules []syslog.RedactionRule
+	for _, r := range cfg.DrainRedactionRules.Rules {
+		rule, err := syslog.NewRedactionRule(r.Name, r.Pattern, r.Replacement)
+		if err != nil {
+			l.Panicf("failed to configure drain redaction: %s", err)
+		}
+		redactionRules = append(redactionRules, rule)
+	}
+
 	connector := syslog.NewSyslogConnector(
 		cfg.DrainSkipCertVerify,
 		timeoutwaitgroup.New(time.Minute),
 		writerFactory,
 		m,
 		syslog.WithLogClient(logClient),
+		syslog.WithRedactionRules(redactionRules...),
 	)
 
+	drainCompression, err := syslog.ParseCompression(cfg.DrainCompression)
+	if err != nil {
+		l.Panicf("failed to configure drain compression: %s", err)
+	}
+	paramParserOpts := []bindings.DrainParamParserOption{
+		bindings.WithDefaultCompression(drainCompression),
+		bindings.WithDefaultRateLimit(cfg.DrainRateLimit, cfg.DrainRateLimitBurst),
+		bindings.WithDefaultHeaderTemplates(cfg.DrainHostnameTemplate, cfg.DrainAppNameTemplate),
+		bindings.WithRedactionRules(redactionRules...),
+		bindings.WithWarnings(logClient, l),
+	}
+
 	var cacheClient *cache.CacheClient
 	var cupsFetcher binding.Fetcher = nil
 	if cfg.Cache.CAFile != "" {
@@ -107,13 +145,14 @@ func NewSyslogAgent(
 			cfg.WarnOnInvalidDrains,
 			l,
 		)
-		cupsFetcher = bindings.NewDrainParamParser(cupsFetcher, cfg.DefaultDrainMetadata)
+		cupsFetcher = bindings.NewDrainParamParser(cupsFetcher, cfg.DefaultDrainMetadata, paramParserOpts...)
 	}
 
 	aggregateFetcher := bindings.NewAggregateDrainFetcher(cfg.AggregateDrainURLs, cacheClient)
+	aggregateParamParserOpts := append(slices.Clip(paramParserOpts), bindings.WithDefaultRedaction(cfg.AggregateDrainRedaction))
 	bindingManager := binding.NewManager(
 		cupsFetcher,
-		bindings.NewDrainParamParser(aggregateFetcher, cfg.DefaultDrainMetadata),
+		bindings.NewDrainParamParser(aggregateFetcher, cfg.DefaultDrainMetadata, aggregateParamParserOpts...),
 		connector,
 		m,
 		cfg.Cache.PollingInterval,
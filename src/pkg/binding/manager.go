@@ -4,6 +4,7 @@ import (
 	"context"
 	"log"
 	"math/rand"
+	"net/url"
 	"sync"
 	"time"
 
@@ -210,7 +211,7 @@ func (m *Manager) resetAggregateDrains() {
 
 		writer, err := m.connector.Connect(aggregateDrainHolder.ctx, b)
 		if err != nil {
-			m.log.Printf("failed to connect to aggregate drain %s: %s", b.Drain, err)
+			m.log.Printf("failed to connect to aggregate drain %s: %s", anonymousURL(b.Drain.Url), err)
 			aggregateDrainHolder.cancel()
 			continue
 		}
@@ -226,6 +227,19 @@ func (m *Manager) resetAggregateDrains() {
 	m.updateActiveDrainCount(int64(len(m.aggregateDrains)))
 }
 
+// anonymousURL returns the drain URL without its user info and query so that
+// it can be logged. The query holds drain parameters such as
+// header-authorization that must not be logged either.
+func anonymousURL(drainURL string) string {
+	u, err := url.Parse(drainURL)
+	if err != nil {
+		return "<invalid url>"
+	}
+	u.User = nil
+	u.RawQuery = ""
+	return u.String()
+}
+
 func (m *Manager) removeDrain(
 	bindingWriterMap map[syslog.Binding]drainHolder,
 	b syslog.Binding,
@@ -46,7 +46,11 @@ type Credentials struct {
 	Cert string `json:"cert" yaml:"cert"`
 	Key  string `json:"key" yaml:"key"`
 	CA   string `json:"ca" yaml:"ca"`
-	Apps []App  `json:"apps"`
+	// Username and Password authenticate with drains that support SASL,
+	// such as kafka drains.
+	Username string `json:"username,omitempty" yaml:"username"`
+	Password string `json:"password,omitempty" yaml:"password"` //nolint:gosec
+	Apps     []App  `json:"apps"`
 }
 
 type App struct {
@@ -60,17 +64,19 @@ type Binding struct {
 }
 
 type AggBinding struct {
-	Url  string `yaml:"url"`
-	Cert string `yaml:"cert"`
-	Key  string `yaml:"key"`
-	CA   string `yaml:"ca"`
+	Url      string `yaml:"url"`
+	Cert     string `yaml:"cert"`
+	Key      string `yaml:"key"`
+	CA       string `yaml:"ca"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"` //nolint:gosec
 }
 
 type Setter interface {
 	Set(bindings []Binding, bindingCount int)
 }
 
-var allowedSchemes = []string{"syslog", "syslog-tls", "https", "https-batch"}
+var allowedSchemes = []string{"syslog", "syslog-tls", "syslog-udp", "https", "https-batch", "splunk-hec", "loki", "elasticsearch", "opensearch", "otlp-https", "gelf", "gelf-tls", "gelf-udp", "relp", "relp-tls"}
 
 func NewPoller(
 	ac client,
@@ -414,6 +414,24 @@ var _ = Describe("Poller", func() {
 			Expect(bndChecker.blacklistedDrains).To(Equal(float64(0)))
 		})
 
+		It("accepts bindings with the syslog-udp scheme", func() {
+			bindings := []Binding{
+				{
+					Url: "syslog-udp://drain-0.com:514",
+					Credentials: []Credentials{
+						{
+							Apps: []App{{Hostname: "app-hostname0", AppID: "app-id-0"}},
+						},
+					},
+				},
+			}
+
+			filteredBindings := bndChecker.checkBindings(bindings)
+
+			Expect(filteredBindings).To(Equal(bindings))
+			Expect(bndChecker.invalidDrains).To(Equal(float64(0)))
+		})
+
 		It("returns no binding if a host cannot be parsed from the given url", func() {
 			bindings := []Binding{
 				{
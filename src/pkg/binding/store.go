@@ -68,9 +68,11 @@ func NewAggregateStore(drainFileName string) *AggregateStore {
 			Url: binding.Url,
 			Credentials: []Credentials{
 				{
-					Cert: binding.Cert,
-					Key:  binding.Key,
-					CA:   binding.CA,
+					Cert:     binding.Cert,
+					Key:      binding.Key,
+					CA:       binding.CA,
+					Username: binding.Username,
+					Password: binding.Password,
 				},
 			},
 		})
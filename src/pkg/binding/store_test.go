@@ -127,6 +127,24 @@ var _ = Describe("Store", func() {
 			},
 		))
 	})
+	It("can read and store drains with usernames and passwords", func() {
+		aggDrainFile := makeAggDrainFile(`---
+- url: "kafka://broker-1;broker-2/logs"
+  username: user
+  password: secret
+`)
+		aggStore := binding.NewAggregateStore(aggDrainFile)
+
+		Expect(aggStore.Get()).To(ConsistOf(
+			binding.Binding{
+				Url: "kafka://broker-1;broker-2/logs",
+				Credentials: []binding.Credentials{{
+					Username: "user",
+					Password: "secret",
+				}},
+			},
+		))
+	})
 })
 
 func makeAggDrainFile(write string) string {
@@ -0,0 +1,146 @@
+package syslog
+
+import (
+	"sync"
+	"time"
+
+	metrics "code.cloudfoundry.org/go-metric-registry"
+)
+
+// CircuitState is the state of a CircuitBreaker.
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreaker stops writes to a drain that keeps failing so that it does
+// not occupy retry capacity shared with healthy drains. The breaker opens
+// after a number of consecutive failed writes. While it is open, writes are
+// dropped until the probe interval has passed. Then a single write is let
+// through to probe the drain: if it succeeds, the breaker closes, otherwise
+// it opens again.
+//
+// A nil CircuitBreaker allows all writes.
+type CircuitBreaker struct {
+	threshold     int
+	probeInterval time.Duration
+	droppedMetric metrics.Counter
+	onStateChange func(from, to CircuitState)
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	probeAt  time.Time
+}
+
+// NewCircuitBreaker returns a closed CircuitBreaker. onStateChange is called
+// for every state transition and may be nil.
+func NewCircuitBreaker(
+	threshold int,
+	probeInterval time.Duration,
+	droppedMetric metrics.Counter,
+	onStateChange func(from, to CircuitState),
+) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold:     threshold,
+		probeInterval: probeInterval,
+		droppedMetric: droppedMetric,
+		onStateChange: onStateChange,
+	}
+}
+
+// Allow reports whether a write of msgCount messages may be attempted. Writes
+// that are not allowed are counted as dropped.
+func (cb *CircuitBreaker) Allow(msgCount float64) bool {
+	if cb == nil {
+		return true
+	}
+
+	cb.mu.Lock()
+	from := cb.state
+	switch cb.state {
+	case CircuitClosed:
+		cb.mu.Unlock()
+		return true
+	case CircuitOpen, CircuitHalfOpen:
+		// A probe that did not report its result within the probe interval
+		// is replaced by a new one.
+		if !time.Now().Before(cb.probeAt) {
+			cb.state = CircuitHalfOpen
+			cb.probeAt = time.Now().Add(cb.probeInterval)
+			cb.mu.Unlock()
+			cb.stateChanged(from, CircuitHalfOpen)
+			return true
+		}
+	}
+	cb.mu.Unlock()
+
+	cb.droppedMetric.Add(msgCount)
+	return false
+}
+
+// Success records a successful write and closes the breaker.
+func (cb *CircuitBreaker) Success() {
+	if cb == nil {
+		return
+	}
+
+	cb.mu.Lock()
+	from := cb.state
+	cb.state = CircuitClosed
+	cb.failures = 0
+	cb.mu.Unlock()
+
+	cb.stateChanged(from, CircuitClosed)
+}
+
+// Failure records a failed write. It opens the breaker once the threshold of
+// consecutive failures is reached or when a probe fails.
+func (cb *CircuitBreaker) Failure() {
+	if cb == nil {
+		return
+	}
+
+	cb.mu.Lock()
+	from := cb.state
+	cb.failures++
+	if cb.state == CircuitHalfOpen || (cb.state == CircuitClosed && cb.failures >= cb.threshold) {
+		cb.state = CircuitOpen
+		cb.probeAt = time.Now().Add(cb.probeInterval)
+	}
+	to := cb.state
+	cb.mu.Unlock()
+
+	cb.stateChanged(from, to)
+}
+
+// State returns the current state of the breaker.
+func (cb *CircuitBreaker) State() CircuitState {
+	if cb == nil {
+		return CircuitClosed
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state
+}
+
+func (cb *CircuitBreaker) stateChanged(from, to CircuitState) {
+	if from != to && cb.onStateChange != nil {
+		cb.onStateChange(from, to)
+	}
+}
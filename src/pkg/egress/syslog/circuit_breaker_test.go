@@ -0,0 +1,114 @@
+package syslog_test
+
+import (
+	"time"
+
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CircuitBreaker", func() {
+	type transition struct {
+		from, to syslog.CircuitState
+	}
+
+	var (
+		cb            *syslog.CircuitBreaker
+		droppedMetric *metricsHelpers.SpyMetric
+		transitions   []transition
+		probeInterval time.Duration
+	)
+
+	BeforeEach(func() {
+		transitions = nil
+		probeInterval = 50 * time.Millisecond
+		droppedMetric = &metricsHelpers.SpyMetric{}
+		cb = syslog.NewCircuitBreaker(3, probeInterval, droppedMetric, func(from, to syslog.CircuitState) {
+			transitions = append(transitions, transition{from, to})
+		})
+	})
+
+	It("allows writes while closed", func() {
+		cb.Failure()
+		cb.Failure()
+
+		Expect(cb.State()).To(Equal(syslog.CircuitClosed))
+		Expect(cb.Allow(1)).To(BeTrue())
+		Expect(transitions).To(BeEmpty())
+	})
+
+	It("opens after the threshold of consecutive failures", func() {
+		cb.Failure()
+		cb.Failure()
+		cb.Success()
+		cb.Failure()
+		cb.Failure()
+		Expect(cb.State()).To(Equal(syslog.CircuitClosed))
+
+		cb.Failure()
+
+		Expect(cb.State()).To(Equal(syslog.CircuitOpen))
+		Expect(transitions).To(Equal([]transition{{syslog.CircuitClosed, syslog.CircuitOpen}}))
+	})
+
+	It("drops writes while open and counts them", func() {
+		for i := 0; i < 3; i++ {
+			cb.Failure()
+		}
+
+		Expect(cb.Allow(10)).To(BeFalse())
+		Expect(cb.Allow(1)).To(BeFalse())
+		Expect(droppedMetric.Value()).To(BeNumerically("==", 11))
+	})
+
+	It("lets a single probe through after the probe interval", func() {
+		for i := 0; i < 3; i++ {
+			cb.Failure()
+		}
+		time.Sleep(probeInterval)
+
+		Expect(cb.Allow(1)).To(BeTrue())
+		Expect(cb.State()).To(Equal(syslog.CircuitHalfOpen))
+		Expect(cb.Allow(1)).To(BeFalse())
+	})
+
+	It("closes when a probe succeeds", func() {
+		for i := 0; i < 3; i++ {
+			cb.Failure()
+		}
+		time.Sleep(probeInterval)
+		Expect(cb.Allow(1)).To(BeTrue())
+
+		cb.Success()
+
+		Expect(cb.State()).To(Equal(syslog.CircuitClosed))
+		Expect(transitions).To(Equal([]transition{
+			{syslog.CircuitClosed, syslog.CircuitOpen},
+			{syslog.CircuitOpen, syslog.CircuitHalfOpen},
+			{syslog.CircuitHalfOpen, syslog.CircuitClosed},
+		}))
+	})
+
+	It("opens again when a probe fails", func() {
+		for i := 0; i < 3; i++ {
+			cb.Failure()
+		}
+		time.Sleep(probeInterval)
+		Expect(cb.Allow(1)).To(BeTrue())
+
+		cb.Failure()
+
+		Expect(cb.State()).To(Equal(syslog.CircuitOpen))
+		Expect(cb.Allow(1)).To(BeFalse())
+	})
+
+	It("allows everything when nil", func() {
+		var nilBreaker *syslog.CircuitBreaker
+
+		Expect(nilBreaker.Allow(1)).To(BeTrue())
+		nilBreaker.Failure()
+		Expect(nilBreaker.State()).To(Equal(syslog.CircuitClosed))
+	})
+})
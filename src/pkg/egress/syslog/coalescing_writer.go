@@ -0,0 +1,163 @@
+package syslog
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxCoalescedSize is the payload size after which a coalesced log is
+// written even if more continuation lines follow.
+const maxCoalescedSize = 64 * 1024
+
+type coalescingKey struct {
+	sourceID   string
+	instanceID string
+	logType    loggregator_v2.Log_Type
+}
+
+type pendingLog struct {
+	env    *loggregator_v2.Envelope
+	cloned bool
+	last   time.Time
+}
+
+// CoalescingWriter merges log lines that continue the previous log of the
+// same source, instance and stream, such as the lines of a stack trace, into
+// a single envelope. A line continues the previous log if it arrives within the window
+// and starts with whitespace, "at " or "Caused by:", or matches the
+// configured pattern.
+type CoalescingWriter struct {
+	writer  egress.Writer
+	window  time.Duration
+	pattern *regexp.Regexp
+
+	mu      sync.Mutex
+	pending map[coalescingKey]*pendingLog
+	stopped chan struct{}
+}
+
+// NewCoalescingWriter returns a writer that holds back logs for up to window
+// to merge continuation lines into them. A nil pattern only uses the default
+// continuation rules. Pending logs are written when the context is done, so w
+// must accept writes until Stopped is closed.
+func NewCoalescingWriter(ctx context.Context, w egress.Writer, window time.Duration, pattern *regexp.Regexp) *CoalescingWriter {
+	cw := &CoalescingWriter{
+		writer:  w,
+		window:  window,
+		pattern: pattern,
+		pending: make(map[coalescingKey]*pendingLog),
+		stopped: make(chan struct{}),
+	}
+	go cw.flushExpired(ctx)
+
+	return cw
+}
+
+func (w *CoalescingWriter) Write(env *loggregator_v2.Envelope) error {
+	if env.GetLog() == nil {
+		return w.writer.Write(env)
+	}
+
+	key := coalescingKey{
+		sourceID:   env.GetSourceId(),
+		instanceID: env.GetInstanceId(),
+		logType:    env.GetLog().GetType(),
+	}
+	now := time.Now()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	p, ok := w.pending[key]
+	if ok && w.continues(p, env, now) {
+		w.appendLine(p, env.GetLog().GetPayload())
+		p.last = now
+		return nil
+	}
+
+	if ok {
+		delete(w.pending, key)
+		if err := w.writer.Write(p.env); err != nil {
+			return err
+		}
+	}
+	w.pending[key] = &pendingLog{env: env, last: now}
+	return nil
+}
+
+func (w *CoalescingWriter) continues(p *pendingLog, env *loggregator_v2.Envelope, now time.Time) bool {
+	if now.Sub(p.last) > w.window {
+		return false
+	}
+
+	line := env.GetLog().GetPayload()
+	if len(p.env.GetLog().GetPayload())+len(line) > maxCoalescedSize {
+		return false
+	}
+	return isContinuationLine(line) || (w.pattern != nil && w.pattern.Match(line))
+}
+
+// appendLine appends the line to the payload of the pending log. The
+// envelope is cloned before it is changed for the first time since it is
+// shared with other drains.
+func (w *CoalescingWriter) appendLine(p *pendingLog, line []byte) {
+	if !p.cloned {
+		p.env = proto.Clone(p.env).(*loggregator_v2.Envelope)
+		p.cloned = true
+	}
+
+	l := p.env.GetLog()
+	payload := bytes.TrimRight(l.Payload, "\r\n")
+	payload = append(payload, '\n')
+	l.Payload = append(payload, line...)
+}
+
+// Stopped is closed once the pending logs are written after the context is
+// done.
+func (w *CoalescingWriter) Stopped() <-chan struct{} {
+	return w.stopped
+}
+
+func (w *CoalescingWriter) flushExpired(ctx context.Context) {
+	ticker := time.NewTicker(w.window)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.flush(time.Time{})
+			close(w.stopped)
+			return
+		case now := <-ticker.C:
+			w.flush(now.Add(-w.window))
+		}
+	}
+}
+
+// flush writes all pending logs that did not receive a line after the given
+// time.
+func (w *CoalescingWriter) flush(before time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for key, p := range w.pending {
+		if !before.IsZero() && p.last.After(before) {
+			continue
+		}
+		delete(w.pending, key)
+		_ = w.writer.Write(p.env)
+	}
+}
+
+func isContinuationLine(line []byte) bool {
+	return len(line) > 0 && (line[0] == ' ' || line[0] == '\t') ||
+		bytes.HasPrefix(line, []byte("at ")) ||
+		bytes.HasPrefix(line, []byte("Caused by:"))
+}
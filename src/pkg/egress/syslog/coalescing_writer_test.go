@@ -0,0 +1,153 @@
+package syslog_test
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CoalescingWriter", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		spy    *recordingWriteCloser
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		spy = &recordingWriteCloser{}
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	logEnvelope := func(sourceID, instanceID, payload string) *loggregator_v2.Envelope {
+		return &loggregator_v2.Envelope{
+			SourceId:   sourceID,
+			InstanceId: instanceID,
+			Message: &loggregator_v2.Envelope_Log{
+				Log: &loggregator_v2.Log{Payload: []byte(payload)},
+			},
+		}
+	}
+
+	payloads := func() []string {
+		var p []string
+		for _, env := range spy.envelopes() {
+			p = append(p, string(env.GetLog().GetPayload()))
+		}
+		return p
+	}
+
+	It("merges continuation lines into a single log", func() {
+		w := syslog.NewCoalescingWriter(ctx, spy, 50*time.Millisecond, nil)
+
+		lines := []string{
+			"java.lang.IllegalStateException: boom\n",
+			"at com.example.Foo.bar(Foo.java:42)\n",
+			"\tat com.example.Foo.main(Foo.java:7)\n",
+			"Caused by: java.io.IOException: nope\n",
+			"    ... 2 more\n",
+			"next log\n",
+		}
+		for _, l := range lines {
+			Expect(w.Write(logEnvelope("app", "0", l))).To(Succeed())
+		}
+
+		Eventually(payloads).Should(Equal([]string{
+			"java.lang.IllegalStateException: boom\n" +
+				"at com.example.Foo.bar(Foo.java:42)\n" +
+				"\tat com.example.Foo.main(Foo.java:7)\n" +
+				"Caused by: java.io.IOException: nope\n" +
+				"    ... 2 more\n",
+			"next log\n",
+		}))
+	})
+
+	It("merges lines matching the configured pattern", func() {
+		w := syslog.NewCoalescingWriter(ctx, spy, 50*time.Millisecond, regexp.MustCompile(`^[A-Za-z]+Error: `))
+
+		Expect(w.Write(logEnvelope("app", "0", "Traceback (most recent call last):"))).To(Succeed())
+		Expect(w.Write(logEnvelope("app", "0", `  File "app.py", line 1, in <module>`))).To(Succeed())
+		Expect(w.Write(logEnvelope("app", "0", "ValueError: bad value"))).To(Succeed())
+
+		Eventually(payloads).Should(Equal([]string{
+			"Traceback (most recent call last):\n" +
+				"  File \"app.py\", line 1, in <module>\n" +
+				"ValueError: bad value",
+		}))
+	})
+
+	It("does not merge lines of different sources or instances", func() {
+		w := syslog.NewCoalescingWriter(ctx, spy, 50*time.Millisecond, nil)
+
+		Expect(w.Write(logEnvelope("app", "0", "first"))).To(Succeed())
+		Expect(w.Write(logEnvelope("app", "1", "  second"))).To(Succeed())
+		Expect(w.Write(logEnvelope("other", "0", "  third"))).To(Succeed())
+
+		Eventually(payloads).Should(ConsistOf("first", "  second", "  third"))
+	})
+
+	It("does not merge lines of different streams", func() {
+		w := syslog.NewCoalescingWriter(ctx, spy, 50*time.Millisecond, nil)
+
+		stderr := logEnvelope("app", "0", "  second")
+		stderr.GetLog().Type = loggregator_v2.Log_ERR
+		Expect(w.Write(logEnvelope("app", "0", "first"))).To(Succeed())
+		Expect(w.Write(stderr)).To(Succeed())
+
+		Eventually(payloads).Should(ConsistOf("first", "  second"))
+	})
+
+	It("does not merge lines arriving after the window", func() {
+		w := syslog.NewCoalescingWriter(ctx, spy, 20*time.Millisecond, nil)
+
+		Expect(w.Write(logEnvelope("app", "0", "first"))).To(Succeed())
+		Eventually(payloads).Should(Equal([]string{"first"}))
+
+		Expect(w.Write(logEnvelope("app", "0", "  second"))).To(Succeed())
+		Eventually(payloads).Should(Equal([]string{"first", "  second"}))
+	})
+
+	It("does not modify the written envelopes", func() {
+		w := syslog.NewCoalescingWriter(ctx, spy, 50*time.Millisecond, nil)
+
+		first := logEnvelope("app", "0", "first")
+		Expect(w.Write(first)).To(Succeed())
+		Expect(w.Write(logEnvelope("app", "0", "  second"))).To(Succeed())
+
+		Eventually(payloads).Should(Equal([]string{"first\n  second"}))
+		Expect(string(first.GetLog().GetPayload())).To(Equal("first"))
+	})
+
+	It("passes other envelopes through", func() {
+		w := syslog.NewCoalescingWriter(ctx, spy, time.Hour, nil)
+
+		counter := &loggregator_v2.Envelope{
+			SourceId: "app",
+			Message: &loggregator_v2.Envelope_Counter{
+				Counter: &loggregator_v2.Counter{Name: "requests", Total: 1},
+			},
+		}
+		Expect(w.Write(counter)).To(Succeed())
+
+		Expect(spy.envelopes()).To(Equal([]*loggregator_v2.Envelope{counter}))
+	})
+
+	It("writes pending logs when the context is done", func() {
+		w := syslog.NewCoalescingWriter(ctx, spy, time.Hour, nil)
+
+		Expect(w.Write(logEnvelope("app", "0", "first"))).To(Succeed())
+		Consistently(payloads, 50*time.Millisecond).Should(BeEmpty())
+
+		cancel()
+		Eventually(w.Stopped()).Should(BeClosed())
+		Expect(payloads()).To(Equal([]string{"first"}))
+	})
+})
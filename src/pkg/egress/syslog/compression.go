@@ -0,0 +1,106 @@
+package syslog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression selects the content encoding of requests sent to https-batch
+// drains.
+type Compression int
+
+const (
+	NoCompression Compression = iota
+	GzipCompression
+	ZstdCompression
+)
+
+// ParseCompression converts the name of a compression algorithm as used in
+// drain URLs and the syslog agent configuration into a Compression.
+func ParseCompression(s string) (Compression, error) {
+	switch s {
+	case "", "none":
+		return NoCompression, nil
+	case "gzip":
+		return GzipCompression, nil
+	case "zstd":
+		return ZstdCompression, nil
+	default:
+		return NoCompression, fmt.Errorf("unsupported compression: %q", s)
+	}
+}
+
+// contentEncoding returns the value of the Content-Encoding header for the
+// compression.
+func (c Compression) contentEncoding() string {
+	switch c {
+	case GzipCompression:
+		return "gzip"
+	case ZstdCompression:
+		return "zstd"
+	default:
+		return ""
+	}
+}
+
+// compressor compresses request bodies. It reuses its encoders and output
+// buffer and is therefore not safe for concurrent use.
+type compressor struct {
+	compression Compression
+	buf         bytes.Buffer
+	zstdBuf     []byte
+	gzipWriter  *gzip.Writer
+	zstdEncoder *zstd.Encoder
+}
+
+func newCompressor(c Compression) (*compressor, error) {
+	comp := &compressor{compression: c}
+
+	switch c {
+	case GzipCompression:
+		comp.gzipWriter = gzip.NewWriter(&comp.buf)
+	case ZstdCompression:
+		enc, err := zstd.NewWriter(nil,
+			zstd.WithEncoderConcurrency(1),
+			zstd.WithLowerEncoderMem(true),
+		)
+		if err != nil {
+			return nil, err
+		}
+		comp.zstdEncoder = enc
+	}
+
+	return comp, nil
+}
+
+// compress returns the compressed form of src. The returned slice is only
+// valid until the next call to compress.
+func (c *compressor) compress(src []byte) ([]byte, error) {
+	switch c.compression {
+	case GzipCompression:
+		c.buf.Reset()
+		c.gzipWriter.Reset(&c.buf)
+		if _, err := c.gzipWriter.Write(src); err != nil {
+			return nil, err
+		}
+		if err := c.gzipWriter.Close(); err != nil {
+			return nil, err
+		}
+		return c.buf.Bytes(), nil
+	case ZstdCompression:
+		c.zstdBuf = c.zstdEncoder.EncodeAll(src, c.zstdBuf[:0])
+		return c.zstdBuf, nil
+	default:
+		return src, nil
+	}
+}
+
+func (c *compressor) close() error {
+	if c.zstdEncoder != nil {
+		return c.zstdEncoder.Close()
+	}
+	return nil
+}
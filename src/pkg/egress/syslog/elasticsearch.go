@@ -0,0 +1,233 @@
+package syslog
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+)
+
+const elasticsearchBulkPath = "/_bulk"
+
+// DefaultElasticsearchIndex is the index pattern used unless the drain URL
+// selects another one with the index parameter.
+const DefaultElasticsearchIndex = "logs-cf-{date}"
+
+var (
+	findIndexPlaceholders      = regexp.MustCompile(`\{[^{}]*\}`)
+	findInvalidIndexCharacters = regexp.MustCompile(`[\\/*?"<>|,#: ]`)
+)
+
+// ElasticsearchConverter serializes every envelope as a document of a bulk
+// request. The tags of the envelope become fields of the document.
+//
+// The index of a document is taken from an index pattern. The placeholder
+// {date} is replaced with the day of the envelope as yyyy.mm.dd, every other
+// placeholder such as {app_name} with the tag of the same name.
+type ElasticsearchConverter struct {
+	*Converter
+	index string
+}
+
+func NewElasticsearchConverter(index string, opts ...ConverterOption) *ElasticsearchConverter {
+	return &ElasticsearchConverter{
+		Converter: NewConverter(opts...),
+		index:     index,
+	}
+}
+
+type bulkAction struct {
+	Create bulkActionMeta `json:"create"`
+}
+
+type bulkActionMeta struct {
+	Index string `json:"_index"`
+}
+
+func (c *ElasticsearchConverter) Convert(env *loggregator_v2.Envelope, defaultHostname string) ([][]byte, error) {
+	return singleMessage(c.ToBulk(env, defaultHostname))
+}
+
+// ToBulk returns the action and the document of the envelope as two newline
+// terminated lines.
+func (c *ElasticsearchConverter) ToBulk(env *loggregator_v2.Envelope, defaultHostname string) ([]byte, error) {
+	doc := make(map[string]any)
+	if !c.omitTags {
+		for k, v := range env.GetTags() {
+			doc[k] = v
+		}
+	}
+
+	switch m := env.GetMessage().(type) {
+	case *loggregator_v2.Envelope_Log:
+		doc["message"] = string(m.Log.GetPayload())
+		doc["log_type"] = m.Log.GetType().String()
+	default:
+		metric := newJSONMetric(env)
+		if metric == nil {
+			return nil, nil
+		}
+		switch {
+		case metric.Gauge != nil:
+			doc["gauge"] = metric.Gauge
+		case metric.Counter != nil:
+			doc["counter"] = metric.Counter
+		case metric.Timer != nil:
+			doc["timer"] = metric.Timer
+		case metric.Event != nil:
+			doc["event"] = metric.Event
+		}
+	}
+
+	doc["@timestamp"] = time.Unix(0, env.GetTimestamp()).UTC().Format(time.RFC3339Nano)
+	doc["source_id"] = env.GetSourceId()
+	doc["instance_id"] = env.GetInstanceId()
+	doc["hostname"] = c.BuildHostname(env, defaultHostname)
+
+	action, err := json.Marshal(bulkAction{Create: bulkActionMeta{Index: c.indexName(env)}})
+	if err != nil {
+		return nil, err
+	}
+	source, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := make([]byte, 0, len(action)+len(source)+2)
+	msg = append(msg, action...)
+	msg = append(msg, '\n')
+	msg = append(msg, source...)
+	return append(msg, '\n'), nil
+}
+
+func (c *ElasticsearchConverter) indexName(env *loggregator_v2.Envelope) string {
+	index := findIndexPlaceholders.ReplaceAllStringFunc(c.index, func(p string) string {
+		name := p[1 : len(p)-1]
+		if name == "date" {
+			return time.Unix(0, env.GetTimestamp()).UTC().Format("2006.01.02")
+		}
+		if v := env.GetTags()[name]; v != "" {
+			return v
+		}
+		return "unknown"
+	})
+
+	return findInvalidIndexCharacters.ReplaceAllString(strings.ToLower(index), "-")
+}
+
+type bulkResponse struct {
+	Errors bool                        `json:"errors"`
+	Items  []map[string]bulkItemResult `json:"items"`
+}
+
+type bulkItemResult struct {
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error"`
+}
+
+var errBulkItemsMismatch = errors.New("bulk response does not match the documents of the batch")
+
+// rejectedBulkItems returns the documents of the batch that were rejected
+// temporarily, because the cluster was overloaded or unavailable, and the
+// number of documents that were rejected permanently, e.g. because of
+// mapping errors. reason is the first permanent error. An error is returned
+// if the response can not be parsed or reports errors that can not be
+// matched to the documents, in which case the whole batch failed.
+func rejectedBulkItems(batch, resp []byte) (rejected []byte, rejectedCount, dropped float64, reason string, err error) {
+	var r bulkResponse
+	if err := json.Unmarshal(resp, &r); err != nil {
+		return nil, 0, 0, "", fmt.Errorf("failed to parse bulk response: %w", err)
+	}
+	if !r.Errors {
+		return nil, 0, 0, "", nil
+	}
+
+	// Every document consists of an action and a source line.
+	lines := bytes.SplitAfter(batch, []byte("\n"))
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) != 2*len(r.Items) {
+		return nil, 0, 0, "", errBulkItemsMismatch
+	}
+
+	for i, item := range r.Items {
+		for _, result := range item {
+			switch {
+			case result.Status < 300:
+			case result.Status == 429 || result.Status >= 500:
+				rejected = append(rejected, lines[2*i]...)
+				rejected = append(rejected, lines[2*i+1]...)
+				rejectedCount++
+			default:
+				dropped++
+				if reason == "" {
+					reason = string(result.Error)
+				}
+			}
+		}
+	}
+
+	return rejected, rejectedCount, dropped, reason, nil
+}
+
+// NewElasticsearchWriter returns an HTTPSBatchWriter that indexes envelopes
+// with the bulk API of Elasticsearch or OpenSearch. The envelopes are sent to
+// /_bulk unless the URL has a path. The index URL parameter holds the index
+// pattern, which defaults to DefaultElasticsearchIndex.
+//
+// Documents that are rejected because the cluster is overloaded or
+// unavailable are retried on their own, documents that are rejected for other
+// reasons are dropped and counted by droppedMetric.
+func NewElasticsearchWriter(
+	binding *URLBinding,
+	netConf NetworkTimeoutConfig,
+	tlsConf *tls.Config,
+	egressMetric metrics.Counter,
+	droppedMetric metrics.Counter,
+	opts []ConverterOption,
+	options ...Option,
+) egress.WriteCloser {
+	esBinding := *binding
+	u := *binding.URL
+	esBinding.URL = &u
+
+	if u.Path == "" || u.Path == "/" {
+		u.Path = elasticsearchBulkPath
+	}
+
+	index := DefaultElasticsearchIndex
+	q := u.Query()
+	if i := q.Get("index"); i != "" {
+		index = i
+		q.Del("index")
+		u.RawQuery = q.Encode()
+	}
+
+	rejected := func(batch, resp []byte) ([]byte, float64, float64, error) {
+		rejected, rejectedCount, dropped, reason, err := rejectedBulkItems(batch, resp)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		if dropped > 0 {
+			droppedMetric.Add(dropped)
+			log.Printf("Elasticsearch drain %s for application %s rejected %.0f documents, dropping them, err: %s",
+				redactedURL(&u), binding.AppID, dropped, reason)
+		}
+		return rejected, rejectedCount, dropped, nil
+	}
+
+	c := NewElasticsearchConverter(index, opts...)
+	options = append(options, withContentType(ndjsonContentType), withRejectedMessages(rejected))
+
+	return NewHTTPSBatchWriter(&esBinding, netConf, tlsConf, egressMetric, c, options...)
+}
@@ -0,0 +1,181 @@
+package syslog_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"log"
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Elasticsearch", func() {
+	Describe("ElasticsearchConverter", func() {
+		It("converts a log envelope to a bulk action and document", func() {
+			c := syslog.NewElasticsearchConverter("logs-{deployment}-{date}")
+			env := buildLogEnvelope("APP", "2", "just a \"test\"", loggregator_v2.Log_ERR)
+			env.Tags["deployment"] = "Some Deployment"
+
+			msg, err := c.ToBulk(env, "test-hostname")
+			Expect(err).ToNot(HaveOccurred())
+
+			lines := bytes.Split(msg, []byte("\n"))
+			Expect(lines).To(HaveLen(3))
+			Expect(lines[0]).To(MatchJSON(`{"create": {"_index": "logs-some-deployment-1970.01.01"}}`))
+			Expect(lines[1]).To(MatchJSON(`{
+				"@timestamp": "1970-01-01T00:00:00.012345678Z",
+				"source_id": "test-app-id",
+				"instance_id": "2",
+				"hostname": "test-hostname",
+				"source_type": "APP",
+				"deployment": "Some Deployment",
+				"message": "just a \"test\"",
+				"log_type": "ERR"
+			}`))
+			Expect(lines[2]).To(BeEmpty())
+		})
+
+		DescribeTable("expands the index pattern",
+			func(pattern string, tags map[string]string, index string) {
+				env := buildCounterEnvelope("1")
+				env.Timestamp = time.Date(2026, 3, 4, 23, 59, 0, 0, time.UTC).UnixNano()
+				env.Tags = tags
+
+				msg, err := syslog.NewElasticsearchConverter(pattern).ToBulk(env, "test-hostname")
+				Expect(err).ToNot(HaveOccurred())
+				action, _, _ := bytes.Cut(msg, []byte("\n"))
+				Expect(action).To(MatchJSON(`{"create": {"_index": "` + index + `"}}`))
+			},
+			Entry("date", "logs-{date}", nil, "logs-2026.03.04"),
+			Entry("tag", "logs-{app_name}", map[string]string{"app_name": "some-app"}, "logs-some-app"),
+			Entry("missing tag", "logs-{app_name}", nil, "logs-unknown"),
+			Entry("empty tag", "logs-{app_name}", map[string]string{"app_name": ""}, "logs-unknown"),
+			Entry("uppercase and invalid characters", "logs-{app_name}", map[string]string{"app_name": "Some App/1"}, "logs-some-app-1"),
+		)
+	})
+
+	Describe("NewElasticsearchWriter", func() {
+		const bulkSuccess = `{"errors": false, "items": []}`
+
+		var (
+			drain          *rawDrain
+			circuitBreaker *syslog.CircuitBreaker
+			egressMetric   *metricsHelpers.SpyMetric
+			droppedMetric  *metricsHelpers.SpyMetric
+		)
+
+		BeforeEach(func() {
+			drain = newRawMockDrain(http.StatusOK)
+			DeferCleanup(drain.Close)
+			circuitBreaker = nil
+		})
+
+		newWriter := func() egress.WriteCloser {
+			b := buildURLBinding(drain.URL+"?index=logs", "test-app-id", "test-hostname")
+			b.URL.Scheme = "elasticsearch"
+			b.Context = context.Background()
+			b.CircuitBreaker = circuitBreaker
+			egressMetric = &metricsHelpers.SpyMetric{}
+			droppedMetric = &metricsHelpers.SpyMetric{}
+
+			writer := syslog.NewElasticsearchWriter(
+				b,
+				syslog.NetworkTimeoutConfig{},
+				&tls.Config{InsecureSkipVerify: true}, //nolint:gosec
+				egressMetric,
+				droppedMetric,
+				nil,
+				syslog.WithSendInterval(50*time.Millisecond),
+			)
+			writer.(syslog.InternalRetryWriter).ConfigureRetry(func(int) time.Duration {
+				return 0
+			}, 3)
+			return writer
+		}
+
+		It("retries only the documents rejected temporarily", func() {
+			drain.respondWith(`{"errors": true, "items": [
+				{"create": {"status": 201}},
+				{"create": {"status": 429, "error": {"type": "es_rejected_execution_exception"}}},
+				{"create": {"status": 400, "error": {"type": "mapper_parsing_exception"}}}
+			]}`, bulkSuccess)
+
+			writer := newWriter()
+			defer writer.Close()
+
+			Expect(writer.Write(buildLogEnvelope("APP", "1", "message 1", loggregator_v2.Log_OUT))).To(Succeed())
+			Expect(writer.Write(buildLogEnvelope("APP", "1", "message 2", loggregator_v2.Log_OUT))).To(Succeed())
+			Expect(writer.Write(buildLogEnvelope("APP", "1", "message 3", loggregator_v2.Log_OUT))).To(Succeed())
+
+			Eventually(drain.getBodies).Should(HaveLen(2))
+			Eventually(egressMetric.Value).Should(BeNumerically("==", 2))
+			Expect(droppedMetric.Value()).To(BeNumerically("==", 1))
+
+			r := drain.getRequests()[0]
+			Expect(r.URL.Path).To(Equal("/_bulk"))
+			Expect(r.URL.RawQuery).To(BeEmpty())
+			Expect(r.Header.Get("Content-Type")).To(Equal("application/x-ndjson"))
+			bodies := drain.getBodies()
+			Expect(bytes.Count(bodies[0], []byte("\n"))).To(Equal(6))
+
+			lines := bytes.Split(bodies[1], []byte("\n"))
+			Expect(lines).To(HaveLen(3))
+			Expect(lines[0]).To(MatchJSON(`{"create": {"_index": "logs"}}`))
+			Expect(string(lines[1])).To(ContainSubstring(`"message":"message 2"`))
+		})
+
+		It("charges the circuit breaker with the documents still being retried", func() {
+			logBuffer := gbytes.NewBuffer()
+			log.SetOutput(logBuffer)
+			DeferCleanup(log.SetOutput, GinkgoWriter)
+
+			breakerDropped := &metricsHelpers.SpyMetric{}
+			circuitBreaker = syslog.NewCircuitBreaker(1, time.Hour, breakerDropped, nil)
+			drain.respondWith(`{"errors": true, "items": [
+				{"create": {"status": 201}},
+				{"create": {"status": 429}},
+				{"create": {"status": 429}}
+			]}`)
+
+			writer := newWriter()
+			defer writer.Close()
+
+			Expect(writer.Write(buildLogEnvelope("APP", "1", "message 1", loggregator_v2.Log_OUT))).To(Succeed())
+			Expect(writer.Write(buildLogEnvelope("APP", "1", "message 2", loggregator_v2.Log_OUT))).To(Succeed())
+			Expect(writer.Write(buildLogEnvelope("APP", "1", "message 3", loggregator_v2.Log_OUT))).To(Succeed())
+
+			Eventually(breakerDropped.Value).Should(BeNumerically("==", 2))
+			Eventually(logBuffer).Should(gbytes.Say("Circuit breaker for .* is open, dropping batch with 2 messages"))
+			Consistently(logBuffer, 200*time.Millisecond).ShouldNot(gbytes.Say("after all retries"))
+			Expect(drain.getBodies()).To(HaveLen(1))
+			Expect(egressMetric.Value()).To(BeNumerically("==", 1))
+		})
+
+		DescribeTable("retries the whole batch if the errors can not be matched to the documents",
+			func(response string) {
+				drain.respondWith(response, bulkSuccess)
+
+				writer := newWriter()
+				defer writer.Close()
+
+				Expect(writer.Write(buildLogEnvelope("APP", "1", "message 1", loggregator_v2.Log_OUT))).To(Succeed())
+				Expect(writer.Write(buildLogEnvelope("APP", "1", "message 2", loggregator_v2.Log_OUT))).To(Succeed())
+
+				Eventually(drain.getBodies).Should(HaveLen(2))
+				Eventually(egressMetric.Value).Should(BeNumerically("==", 2))
+				Expect(droppedMetric.Value()).To(BeZero())
+				Expect(drain.getBodies()[1]).To(Equal(drain.getBodies()[0]))
+			},
+			Entry("mismatching items", `{"errors": true, "items": [{"create": {"status": 429}}]}`),
+			Entry("unparsable response", `<html>Bad Gateway</html>`),
+		)
+	})
+})
@@ -2,9 +2,13 @@ package syslog
 
 import (
 	"errors"
+	"regexp"
+	"strings"
 
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+	"google.golang.org/protobuf/proto"
 )
 
 type DrainData int
@@ -18,23 +22,83 @@ const (
 	LOGS_AND_METRICS
 )
 
+// LogType selects the logs written to a drain by their stream.
+type LogType int
+
+const (
+	AllLogTypes LogType = iota
+	OutLogs
+	ErrLogs
+)
+
+var errInvalidBindingType = errors.New("invalid binding type")
+
+func (d DrainData) valid() bool {
+	return d >= LOGS && d <= LOGS_AND_METRICS
+}
+
 type FilteringDrainWriter struct {
 	binding Binding
 	writer  egress.Writer
+
+	includeSourceTypes []string
+	excludeSourceTypes []string
+	includeMetrics     *regexp.Regexp
+	excludeMetrics     *regexp.Regexp
+	filteredMetric     metrics.Counter
 }
 
-func NewFilteringDrainWriter(binding Binding, writer egress.Writer) (*FilteringDrainWriter, error) {
-	if binding.DrainData < LOGS || binding.DrainData > LOGS_AND_METRICS {
-		return nil, errors.New("invalid binding type")
+// FilteringDrainWriterOption allows a filtering drain writer to be
+// customized.
+type FilteringDrainWriterOption func(*FilteringDrainWriter)
+
+// WithFilteredMetric sets the counter for envelopes that are filtered by the
+// source type, stream or metric name filters of the binding.
+func WithFilteredMetric(m metrics.Counter) FilteringDrainWriterOption {
+	return func(w *FilteringDrainWriter) {
+		w.filteredMetric = m
+	}
+}
+
+func NewFilteringDrainWriter(binding Binding, writer egress.Writer, opts ...FilteringDrainWriterOption) (*FilteringDrainWriter, error) {
+	if !binding.DrainData.valid() {
+		return nil, errInvalidBindingType
 	}
 
-	return &FilteringDrainWriter{
-		binding: binding,
-		writer:  writer,
-	}, nil
+	w := &FilteringDrainWriter{
+		binding:            binding,
+		writer:             writer,
+		includeSourceTypes: splitSourceTypes(binding.IncludeSourceTypes),
+		excludeSourceTypes: splitSourceTypes(binding.ExcludeSourceTypes),
+		includeMetrics:     compileGlobs(binding.MetricsInclude),
+		excludeMetrics:     compileGlobs(binding.MetricsExclude),
+	}
+	for _, o := range opts {
+		o(w)
+	}
+	return w, nil
 }
 
 func (w *FilteringDrainWriter) Write(env *loggregator_v2.Envelope) error {
+	all := w.binding.DrainData == ALL
+	switch {
+	case env.GetLog() != nil && (all || sendsLogs(w.binding.DrainData)):
+		if !w.allowsLog(env) {
+			w.countFiltered()
+			return nil
+		}
+	case env.GetCounter() != nil && (all || sendsMetrics(w.binding.DrainData)):
+		if !w.allowsMetric(env.GetCounter().GetName()) {
+			w.countFiltered()
+			return nil
+		}
+	case env.GetGauge() != nil && (all || sendsMetrics(w.binding.DrainData)):
+		if env = w.pruneGauge(env); env == nil {
+			w.countFiltered()
+			return nil
+		}
+	}
+
 	if w.binding.DrainData == ALL {
 		return w.writer.Write(env)
 	}
@@ -63,6 +127,123 @@ func (w *FilteringDrainWriter) Write(env *loggregator_v2.Envelope) error {
 	return nil
 }
 
+// allowsLog reports whether the log passes the source type and stream
+// filters of the binding.
+func (w *FilteringDrainWriter) allowsLog(env *loggregator_v2.Envelope) bool {
+	switch w.binding.LogType {
+	case OutLogs:
+		if env.GetLog().GetType() != loggregator_v2.Log_OUT {
+			return false
+		}
+	case ErrLogs:
+		if env.GetLog().GetType() != loggregator_v2.Log_ERR {
+			return false
+		}
+	}
+
+	sourceType := env.GetTags()["source_type"]
+	if matchesSourceType(sourceType, w.excludeSourceTypes) {
+		return false
+	}
+	return len(w.includeSourceTypes) == 0 || matchesSourceType(sourceType, w.includeSourceTypes)
+}
+
+// allowsMetric reports whether the counter or gauge metric passes the metric
+// name filters of the binding.
+func (w *FilteringDrainWriter) allowsMetric(name string) bool {
+	if w.excludeMetrics != nil && w.excludeMetrics.MatchString(name) {
+		return false
+	}
+	return w.includeMetrics == nil || w.includeMetrics.MatchString(name)
+}
+
+// pruneGauge returns the gauge envelope without the metrics that do not pass
+// the metric name filters, or nil if none of them passes. The envelope is
+// copied before it is changed since it is shared with other drains.
+func (w *FilteringDrainWriter) pruneGauge(env *loggregator_v2.Envelope) *loggregator_v2.Envelope {
+	var denied []string
+	for name := range env.GetGauge().GetMetrics() {
+		if !w.allowsMetric(name) {
+			denied = append(denied, name)
+		}
+	}
+	if len(denied) == 0 {
+		return env
+	}
+	if len(denied) == len(env.GetGauge().GetMetrics()) {
+		return nil
+	}
+
+	env = proto.Clone(env).(*loggregator_v2.Envelope)
+	for _, name := range denied {
+		delete(env.GetGauge().Metrics, name)
+	}
+	return env
+}
+
+func (w *FilteringDrainWriter) countFiltered() {
+	if w.filteredMetric != nil {
+		w.filteredMetric.Add(1)
+	}
+}
+
+// compileGlobs returns a regular expression that matches any of the comma
+// separated glob patterns, in which * matches any sequence of characters and
+// ? a single character. It returns nil if there are no patterns.
+func compileGlobs(s string) *regexp.Regexp {
+	var patterns []string
+	for _, g := range strings.Split(s, ",") {
+		if g = strings.TrimSpace(g); g == "" {
+			continue
+		}
+		p := regexp.QuoteMeta(g)
+		p = strings.ReplaceAll(p, `\*`, ".*")
+		p = strings.ReplaceAll(p, `\?`, ".")
+		patterns = append(patterns, p)
+	}
+	if len(patterns) == 0 {
+		return nil
+	}
+	return regexp.MustCompile("^(?:" + strings.Join(patterns, "|") + ")$")
+}
+
+// matchesSourceType reports whether one of the patterns matches whole
+// components of the source type, so that "APP", "PROC" and "APP/PROC" all
+// match "APP/PROC/WEB" but "AP" does not. The comparison is case insensitive.
+func matchesSourceType(sourceType string, patterns []string) bool {
+	for {
+		for _, p := range patterns {
+			if hasSourceTypePrefix(sourceType, p) {
+				return true
+			}
+		}
+		_, rest, ok := strings.Cut(sourceType, "/")
+		if !ok {
+			return false
+		}
+		sourceType = rest
+	}
+}
+
+// hasSourceTypePrefix reports whether the source type equals the pattern or
+// starts with it followed by a slash.
+func hasSourceTypePrefix(sourceType, p string) bool {
+	if len(sourceType) < len(p) || !strings.EqualFold(sourceType[:len(p)], p) {
+		return false
+	}
+	return len(sourceType) == len(p) || sourceType[len(p)] == '/'
+}
+
+func splitSourceTypes(s string) []string {
+	var sourceTypes []string
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			sourceTypes = append(sourceTypes, t)
+		}
+	}
+	return sourceTypes
+}
+
 func sendsLogs(drainData DrainData) bool {
 	switch drainData {
 	case LOGS:
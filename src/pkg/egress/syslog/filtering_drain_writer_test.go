@@ -2,6 +2,7 @@ package syslog_test
 
 import (
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -44,6 +45,166 @@ var _ = Describe("Filtering Drain Writer", func() {
 		Entry("metrics and logs", syslog.LOGS_AND_METRICS, true, true, false, false),
 	)
 
+	Describe("log filters", func() {
+		logEnvelope := func(sourceType string, logType loggregator_v2.Log_Type) *loggregator_v2.Envelope {
+			return &loggregator_v2.Envelope{
+				Tags:    map[string]string{"source_type": sourceType},
+				Message: &loggregator_v2.Envelope_Log{Log: &loggregator_v2.Log{Type: logType}},
+			}
+		}
+
+		DescribeTable("filters logs by source type and stream", func(binding syslog.Binding, env *loggregator_v2.Envelope, written bool) {
+			fakeWriter := &fakeWriter{}
+			sm := metricsHelpers.NewMetricsRegistry()
+			drain, err := syslog.NewFilteringDrainWriter(binding, fakeWriter, syslog.WithFilteredMetric(sm.NewCounter("filtered", "")))
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(drain.Write(env)).To(Succeed())
+
+			if written {
+				Expect(fakeWriter.received).To(Equal(1))
+				Expect(sm.GetMetric("filtered", nil).Value()).To(BeZero())
+			} else {
+				Expect(fakeWriter.received).To(BeZero())
+				Expect(sm.GetMetric("filtered", nil).Value()).To(BeNumerically("==", 1))
+			}
+		},
+			Entry("included source type", syslog.Binding{IncludeSourceTypes: "APP,STG"}, logEnvelope("APP/PROC/WEB", loggregator_v2.Log_OUT), true),
+			Entry("included source type ignoring case", syslog.Binding{IncludeSourceTypes: "app"}, logEnvelope("APP/PROC/WEB", loggregator_v2.Log_OUT), true),
+			Entry("not included source type", syslog.Binding{IncludeSourceTypes: "APP,STG"}, logEnvelope("RTR", loggregator_v2.Log_OUT), false),
+			Entry("included source type component", syslog.Binding{IncludeSourceTypes: "APP,PROC"}, logEnvelope("APP/PROC/WEB", loggregator_v2.Log_OUT), true),
+			Entry("included nested source type components", syslog.Binding{IncludeSourceTypes: "proc/web"}, logEnvelope("APP/PROC/WEB", loggregator_v2.Log_OUT), true),
+			Entry("partial source type component", syslog.Binding{IncludeSourceTypes: "PRO"}, logEnvelope("APP/PROC/WEB", loggregator_v2.Log_OUT), false),
+			Entry("source type prefix that is no component", syslog.Binding{IncludeSourceTypes: "AP"}, logEnvelope("APP/PROC/WEB", loggregator_v2.Log_OUT), false),
+			Entry("excluded source type", syslog.Binding{ExcludeSourceTypes: "RTR"}, logEnvelope("RTR", loggregator_v2.Log_OUT), false),
+			Entry("excluded nested source type", syslog.Binding{IncludeSourceTypes: "APP", ExcludeSourceTypes: "APP/TASK"}, logEnvelope("APP/TASK/migrate", loggregator_v2.Log_OUT), false),
+			Entry("not excluded source type", syslog.Binding{ExcludeSourceTypes: "RTR"}, logEnvelope("APP/PROC/WEB", loggregator_v2.Log_OUT), true),
+			Entry("excluded source type component", syslog.Binding{ExcludeSourceTypes: "TASK"}, logEnvelope("APP/TASK/migrate", loggregator_v2.Log_OUT), false),
+			Entry("stderr for err log type", syslog.Binding{LogType: syslog.ErrLogs}, logEnvelope("APP/PROC/WEB", loggregator_v2.Log_ERR), true),
+			Entry("stdout for err log type", syslog.Binding{LogType: syslog.ErrLogs}, logEnvelope("APP/PROC/WEB", loggregator_v2.Log_OUT), false),
+			Entry("stderr for out log type", syslog.Binding{LogType: syslog.OutLogs}, logEnvelope("APP/PROC/WEB", loggregator_v2.Log_ERR), false),
+		)
+
+		It("does not filter other envelopes", func() {
+			fakeWriter := &fakeWriter{}
+			binding := syslog.Binding{DrainData: syslog.ALL, IncludeSourceTypes: "APP", LogType: syslog.ErrLogs}
+			drain, err := syslog.NewFilteringDrainWriter(binding, fakeWriter)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(drain.Write(&loggregator_v2.Envelope{
+				Tags:    map[string]string{"source_type": "RTR"},
+				Message: &loggregator_v2.Envelope_Counter{Counter: &loggregator_v2.Counter{}},
+			})).To(Succeed())
+
+			Expect(fakeWriter.received).To(Equal(1))
+		})
+	})
+
+	Describe("metric filters", func() {
+		counterEnvelope := func(name string) *loggregator_v2.Envelope {
+			return &loggregator_v2.Envelope{
+				Message: &loggregator_v2.Envelope_Counter{Counter: &loggregator_v2.Counter{Name: name}},
+			}
+		}
+
+		gaugeEnvelope := func(names ...string) *loggregator_v2.Envelope {
+			m := make(map[string]*loggregator_v2.GaugeValue)
+			for _, n := range names {
+				m[n] = &loggregator_v2.GaugeValue{Unit: "bytes", Value: 1}
+			}
+			return &loggregator_v2.Envelope{
+				Message: &loggregator_v2.Envelope_Gauge{Gauge: &loggregator_v2.Gauge{Metrics: m}},
+			}
+		}
+
+		gaugeNames := func(env *loggregator_v2.Envelope) []string {
+			var names []string
+			for n := range env.GetGauge().GetMetrics() {
+				names = append(names, n)
+			}
+			return names
+		}
+
+		DescribeTable("filters counters by name", func(binding syslog.Binding, name string, written bool) {
+			fakeWriter := &fakeWriter{}
+			binding.DrainData = syslog.ALL
+			sm := metricsHelpers.NewMetricsRegistry()
+			drain, err := syslog.NewFilteringDrainWriter(binding, fakeWriter, syslog.WithFilteredMetric(sm.NewCounter("filtered", "")))
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(drain.Write(counterEnvelope(name))).To(Succeed())
+
+			if written {
+				Expect(fakeWriter.received).To(Equal(1))
+				Expect(sm.GetMetric("filtered", nil).Value()).To(BeZero())
+			} else {
+				Expect(fakeWriter.received).To(BeZero())
+				Expect(sm.GetMetric("filtered", nil).Value()).To(BeNumerically("==", 1))
+			}
+		},
+			Entry("included name", syslog.Binding{MetricsInclude: "requests"}, "requests", true),
+			Entry("included glob", syslog.Binding{MetricsInclude: "http.*, cpu"}, "http.requests", true),
+			Entry("single character glob", syslog.Binding{MetricsInclude: "disk?"}, "disk1", true),
+			Entry("not included name", syslog.Binding{MetricsInclude: "http.*"}, "requests", false),
+			Entry("glob matching a part of the name", syslog.Binding{MetricsInclude: "http"}, "http.requests", false),
+			Entry("excluded glob", syslog.Binding{MetricsExclude: "*.debug"}, "requests.debug", false),
+			Entry("excluded included name", syslog.Binding{MetricsInclude: "http.*", MetricsExclude: "http.debug"}, "http.debug", false),
+			Entry("not excluded name", syslog.Binding{MetricsExclude: "*.debug"}, "requests", true),
+		)
+
+		It("prunes gauges to the allowed metrics", func() {
+			spy := &recordingWriteCloser{}
+			binding := syslog.Binding{DrainData: syslog.METRICS, MetricsInclude: "memory*,disk", MetricsExclude: "memory_quota"}
+			drain, err := syslog.NewFilteringDrainWriter(binding, spy)
+			Expect(err).ToNot(HaveOccurred())
+
+			env := gaugeEnvelope("cpu", "memory", "memory_quota", "disk")
+			Expect(drain.Write(env)).To(Succeed())
+
+			Expect(spy.envelopes()).To(HaveLen(1))
+			Expect(gaugeNames(spy.envelopes()[0])).To(ConsistOf("memory", "disk"))
+			Expect(gaugeNames(env)).To(ConsistOf("cpu", "memory", "memory_quota", "disk"))
+		})
+
+		It("writes gauges with only allowed metrics unchanged", func() {
+			spy := &recordingWriteCloser{}
+			binding := syslog.Binding{DrainData: syslog.METRICS, MetricsExclude: "debug.*"}
+			drain, err := syslog.NewFilteringDrainWriter(binding, spy)
+			Expect(err).ToNot(HaveOccurred())
+
+			env := gaugeEnvelope("cpu", "memory")
+			Expect(drain.Write(env)).To(Succeed())
+
+			Expect(spy.envelopes()).To(Equal([]*loggregator_v2.Envelope{env}))
+		})
+
+		It("drops gauges without allowed metrics", func() {
+			fakeWriter := &fakeWriter{}
+			binding := syslog.Binding{DrainData: syslog.METRICS, MetricsInclude: "cpu"}
+			sm := metricsHelpers.NewMetricsRegistry()
+			drain, err := syslog.NewFilteringDrainWriter(binding, fakeWriter, syslog.WithFilteredMetric(sm.NewCounter("filtered", "")))
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(drain.Write(gaugeEnvelope("memory", "disk"))).To(Succeed())
+
+			Expect(fakeWriter.received).To(BeZero())
+			Expect(sm.GetMetric("filtered", nil).Value()).To(BeNumerically("==", 1))
+		})
+
+		It("does not filter logs", func() {
+			fakeWriter := &fakeWriter{}
+			binding := syslog.Binding{DrainData: syslog.ALL, MetricsInclude: "cpu"}
+			drain, err := syslog.NewFilteringDrainWriter(binding, fakeWriter)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(drain.Write(&loggregator_v2.Envelope{
+				Message: &loggregator_v2.Envelope_Log{Log: &loggregator_v2.Log{Payload: []byte("memory")}},
+			})).To(Succeed())
+
+			Expect(fakeWriter.received).To(Equal(1))
+		})
+	})
+
 	It("errors on invalid binding type", func() {
 		binding := syslog.Binding{AppId: "app-1", Hostname: "host-1",
 			Drain: syslog.Drain{
@@ -0,0 +1,40 @@
+package syslog
+
+import "code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+
+// Format selects the serialization used for messages sent to a drain.
+type Format int
+
+const (
+	FormatRFC5424 Format = iota
+	FormatRFC3164
+	FormatJSON
+)
+
+// MessageConverter serializes an envelope into one or more messages that
+// are ready to be written to a drain.
+type MessageConverter interface {
+	Convert(env *loggregator_v2.Envelope, defaultHostname string) ([][]byte, error)
+}
+
+// NewMessageConverter returns the converter for the given format.
+func NewMessageConverter(f Format, opts ...ConverterOption) MessageConverter {
+	switch f {
+	case FormatRFC3164:
+		return NewRFC3164Converter(opts...)
+	case FormatJSON:
+		return NewJSONConverter(opts...)
+	default:
+		return NewConverter(opts...)
+	}
+}
+
+// singleMessage returns the message a converter serialized an envelope into.
+// Envelopes without a supported message type are serialized into a nil
+// message and result in no messages.
+func singleMessage(msg []byte, err error) ([][]byte, error) {
+	if err != nil || msg == nil {
+		return nil, err
+	}
+	return [][]byte{msg}, nil
+}
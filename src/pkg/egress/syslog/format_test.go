@@ -0,0 +1,24 @@
+package syslog_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+)
+
+var _ = Describe("MessageConverter", func() {
+	DescribeTable("converts envelopes without a message to no messages",
+		func(c syslog.MessageConverter) {
+			env := &loggregator_v2.Envelope{SourceId: "test-app-id"}
+
+			Expect(c.Convert(env, "test-hostname")).To(BeEmpty())
+		},
+		Entry("JSON", syslog.NewJSONConverter()),
+		Entry("HEC", syslog.NewHECConverter("")),
+		Entry("Loki", syslog.NewLokiConverter(syslog.DefaultLokiLabels)),
+		Entry("Elasticsearch", syslog.NewElasticsearchConverter(syslog.DefaultElasticsearchIndex)),
+		Entry("GELF", syslog.NewGELFConverter()),
+	)
+})
@@ -0,0 +1,38 @@
+package syslog
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// Framing selects how messages are delimited on stream based transports as
+// described in RFC 6587.
+type Framing int
+
+const (
+	// OctetCounting prefixes every message with its length in bytes.
+	OctetCounting Framing = iota
+	// NonTransparentLF terminates every message with a line feed.
+	NonTransparentLF
+	// NonTransparentNUL terminates every message with a null byte.
+	NonTransparentNUL
+)
+
+var escapedNewline = []byte(`\n`)
+
+// frame returns msg delimited according to the framing. With
+// non-transparent framing the trailer must not appear inside a message, so
+// embedded line feeds are escaped and embedded nulls are removed.
+func (f Framing) frame(msg []byte) []byte {
+	switch f {
+	case NonTransparentLF:
+		msg = bytes.TrimSuffix(msg, []byte("\n"))
+		msg = bytes.ReplaceAll(msg, []byte("\n"), escapedNewline)
+		return append(msg, '\n')
+	case NonTransparentNUL:
+		msg = bytes.TrimSuffix(removeNulls(msg), []byte("\n"))
+		return append(msg, 0)
+	default:
+		return []byte(strconv.Itoa(len(msg)) + " " + string(msg))
+	}
+}
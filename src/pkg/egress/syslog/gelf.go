@@ -0,0 +1,166 @@
+package syslog
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math/rand/v2"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+	v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/ingress/v2"
+)
+
+// GELF levels are syslog severities.
+const (
+	gelfLevelError = 3
+	gelfLevelInfo  = 6
+)
+
+const (
+	// gelfChunkSize is the largest datagram sent to GELF UDP drains, it is
+	// the size Graylog recommends for networks outside of a LAN.
+	gelfChunkSize = 1420
+	// gelfMaxChunks is the largest number of chunks a GELF message can be
+	// split into.
+	gelfMaxChunks = 128
+	// gelfChunkHeaderSize consists of the magic bytes, the message ID, the
+	// sequence number and the sequence count.
+	gelfChunkHeaderSize = 12
+)
+
+var findInvalidCharactersGELFField = regexp.MustCompile(`[^\w.\-]`)
+
+// GELFConverter serializes envelopes as GELF 1.1 messages for Graylog. Tags
+// become additional fields, the log type selects the level of logs and the
+// values of metrics become numeric additional fields.
+type GELFConverter struct {
+	*Converter
+}
+
+func NewGELFConverter(opts ...ConverterOption) *GELFConverter {
+	return &GELFConverter{
+		Converter: NewConverter(opts...),
+	}
+}
+
+func (c *GELFConverter) Convert(env *loggregator_v2.Envelope, defaultHostname string) ([][]byte, error) {
+	return singleMessage(c.ToGELF(env, defaultHostname))
+}
+
+// ToGELF returns the envelope as GELF message.
+func (c *GELFConverter) ToGELF(env *loggregator_v2.Envelope, defaultHostname string) ([]byte, error) {
+	msg := map[string]any{
+		"version":      "1.1",
+		"host":         c.BuildHostname(env, defaultHostname),
+		"timestamp":    json.Number(strconv.FormatFloat(float64(env.GetTimestamp())/1e9, 'f', 3, 64)),
+		"level":        gelfLevelInfo,
+		"_source_id":   env.GetSourceId(),
+		"_instance_id": env.GetInstanceId(),
+	}
+	if !c.omitTags {
+		for k, v := range env.GetTags() {
+			msg[gelfField(k)] = v
+		}
+	}
+
+	switch m := env.GetMessage().(type) {
+	case *loggregator_v2.Envelope_Log:
+		payload := strings.TrimRight(string(m.Log.GetPayload()), "\n")
+		short, _, multiline := strings.Cut(payload, "\n")
+		msg["short_message"] = short
+		if multiline {
+			msg["full_message"] = payload
+		}
+		if m.Log.GetType() == loggregator_v2.Log_ERR {
+			msg["level"] = gelfLevelError
+		}
+	case *loggregator_v2.Envelope_Gauge:
+		names := make([]string, 0, len(m.Gauge.GetMetrics()))
+		for name, g := range m.Gauge.GetMetrics() {
+			names = append(names, name)
+			msg[gelfField(name)] = g.GetValue()
+		}
+		sort.Strings(names)
+		msg["short_message"] = "gauge " + strings.Join(names, ", ")
+	case *loggregator_v2.Envelope_Counter:
+		name := m.Counter.GetName()
+		msg["short_message"] = "counter " + name
+		msg[gelfField(name)] = m.Counter.GetTotal()
+		msg[gelfField(name+"_delta")] = m.Counter.GetDelta()
+	case *loggregator_v2.Envelope_Timer:
+		name := m.Timer.GetName()
+		msg["short_message"] = "timer " + name
+		msg[gelfField(name+"_start")] = m.Timer.GetStart()
+		msg[gelfField(name+"_stop")] = m.Timer.GetStop()
+		msg[gelfField(name+"_duration")] = m.Timer.GetStop() - m.Timer.GetStart()
+	case *loggregator_v2.Envelope_Event:
+		msg["short_message"] = m.Event.GetTitle()
+		msg["full_message"] = m.Event.GetBody()
+	default:
+		return nil, nil
+	}
+
+	if msg["short_message"] == "" {
+		// Graylog rejects messages without short_message.
+		msg["short_message"] = "-"
+	}
+
+	return json.Marshal(msg)
+}
+
+// gelfField returns the name of the additional field for name. The field
+// _id is reserved by GELF.
+func gelfField(name string) string {
+	name = findInvalidCharactersGELFField.ReplaceAllString(name, "_")
+	if name == "id" {
+		name = "tag_id"
+	}
+	return "_" + name
+}
+
+// NewGELFUDPWriter returns a UDPWriter that sends GELF messages. Messages
+// that do not fit into a single datagram are chunked, messages that need more
+// than 128 chunks are dropped.
+func NewGELFUDPWriter(
+	binding *URLBinding,
+	netConf NetworkTimeoutConfig,
+	egressMetric metrics.Counter,
+	droppedMetric metrics.Counter,
+	appLogClient v2.LogClient,
+	opts ...ConverterOption,
+) egress.WriteCloser {
+	return newUDPWriter(binding, netConf, egressMetric, droppedMetric, NewGELFConverter(opts...), appLogClient, gelfChunks)
+}
+
+// gelfChunks splits msg into GELF chunks if it exceeds gelfChunkSize.
+func gelfChunks(msg []byte, _ int) [][]byte {
+	if len(msg) <= gelfChunkSize {
+		return [][]byte{msg}
+	}
+
+	dataSize := gelfChunkSize - gelfChunkHeaderSize
+	count := (len(msg) + dataSize - 1) / dataSize
+	if count > gelfMaxChunks {
+		return nil
+	}
+
+	id := rand.Uint64() //nolint:gosec
+	chunks := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		data := msg[i*dataSize : min((i+1)*dataSize, len(msg))]
+
+		chunk := make([]byte, gelfChunkHeaderSize, gelfChunkHeaderSize+len(data))
+		chunk[0], chunk[1] = 0x1e, 0x0f
+		binary.BigEndian.PutUint64(chunk[2:10], id)
+		chunk[10] = byte(i)
+		chunk[11] = byte(count)
+		chunks = append(chunks, append(chunk, data...))
+	}
+
+	return chunks
+}
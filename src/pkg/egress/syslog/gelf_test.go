@@ -0,0 +1,160 @@
+package syslog_test
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	"code.cloudfoundry.org/loggregator-agent-release/src/internal/testhelper"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GELF", func() {
+	Describe("GELFConverter", func() {
+		var c *syslog.GELFConverter
+
+		BeforeEach(func() {
+			c = syslog.NewGELFConverter()
+		})
+
+		It("converts a log envelope to a GELF message", func() {
+			env := buildLogEnvelope("APP", "2", "just a test\n", loggregator_v2.Log_OUT)
+			env.Tags["id"] = "some-id"
+			env.Tags["app name"] = "some-app"
+
+			Expect(c.ToGELF(env, "test-hostname")).To(MatchJSON(`{
+				"version": "1.1",
+				"host": "test-hostname",
+				"timestamp": 0.012,
+				"level": 6,
+				"short_message": "just a test",
+				"_source_id": "test-app-id",
+				"_instance_id": "2",
+				"_source_type": "APP",
+				"_tag_id": "some-id",
+				"_app_name": "some-app"
+			}`))
+		})
+
+		It("sets the error level and full message for multi-line errors", func() {
+			env := buildLogEnvelope("APP", "2", "panic: oops\ngoroutine 1", loggregator_v2.Log_ERR)
+
+			Expect(c.Convert(env, "test-hostname")).To(ConsistOf(MatchJSON(`{
+				"version": "1.1",
+				"host": "test-hostname",
+				"timestamp": 0.012,
+				"level": 3,
+				"short_message": "panic: oops",
+				"full_message": "panic: oops\ngoroutine 1",
+				"_source_id": "test-app-id",
+				"_instance_id": "2",
+				"_source_type": "APP"
+			}`)))
+		})
+
+		It("converts gauges to numeric fields", func() {
+			Expect(c.ToGELF(buildGaugeEnvelope("1"), "test-hostname")).To(MatchJSON(`{
+				"version": "1.1",
+				"host": "test-hostname",
+				"timestamp": 0.012,
+				"level": 6,
+				"short_message": "gauge cpu, disk, disk_quota, memory, memory_quota",
+				"_source_id": "test-app-id",
+				"_instance_id": "1",
+				"_cpu": 0.23,
+				"_disk": 1234,
+				"_disk_quota": 1024,
+				"_memory": 5423,
+				"_memory_quota": 8000
+			}`))
+		})
+
+		It("sets a placeholder short message for empty logs", func() {
+			env := buildLogEnvelope("APP", "2", "", loggregator_v2.Log_OUT)
+
+			msg, err := c.ToGELF(env, "test-hostname")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(msg)).To(ContainSubstring(`"short_message":"-"`))
+		})
+	})
+
+	Describe("NewGELFUDPWriter", func() {
+		var (
+			listener      net.PacketConn
+			writer        egress.WriteCloser
+			egressCounter *metricsHelpers.SpyMetric
+		)
+
+		BeforeEach(func() {
+			var err error
+			listener, err = net.ListenPacket("udp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+
+			u, err := url.Parse(fmt.Sprintf("gelf-udp://%s", listener.LocalAddr()))
+			Expect(err).ToNot(HaveOccurred())
+
+			egressCounter = &metricsHelpers.SpyMetric{}
+			writer = syslog.NewGELFUDPWriter(
+				&syslog.URLBinding{AppID: "test-app-id", Hostname: "test-hostname", URL: u},
+				syslog.NetworkTimeoutConfig{WriteTimeout: time.Second, DialTimeout: 100 * time.Millisecond},
+				egressCounter,
+				&metricsHelpers.SpyMetric{},
+				testhelper.NewSpyLogClient(),
+			)
+		})
+
+		AfterEach(func() {
+			writer.Close()
+			listener.Close()
+		})
+
+		readDatagram := func() []byte {
+			buf := make([]byte, 65536)
+			Expect(listener.SetReadDeadline(time.Now().Add(time.Second))).To(Succeed())
+			n, _, err := listener.ReadFrom(buf)
+			Expect(err).ToNot(HaveOccurred())
+			return buf[:n]
+		}
+
+		It("sends small messages in a single datagram", func() {
+			env := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
+			Expect(writer.Write(env)).To(Succeed())
+
+			Expect(string(readDatagram())).To(ContainSubstring(`"short_message":"just a test"`))
+			Expect(egressCounter.Value()).To(BeNumerically("==", 1))
+		})
+
+		It("chunks large messages", func() {
+			payload := strings.Repeat("a", 3000)
+			env := buildLogEnvelope("APP", "2", payload, loggregator_v2.Log_OUT)
+			Expect(writer.Write(env)).To(Succeed())
+
+			var msg []byte
+			var id []byte
+			for i := 0; i < 3; i++ {
+				chunk := readDatagram()
+				Expect(len(chunk)).To(BeNumerically("<=", 1420))
+				Expect(chunk[:2]).To(Equal([]byte{0x1e, 0x0f}))
+				if id == nil {
+					id = chunk[2:10]
+				}
+				Expect(chunk[2:10]).To(Equal(id))
+				Expect(chunk[10]).To(Equal(byte(i)))
+				Expect(chunk[11]).To(Equal(byte(3)))
+				msg = append(msg, chunk[12:]...)
+			}
+
+			Expect(bytes.Contains(msg, []byte(`"short_message":"`+payload+`"`))).To(BeTrue())
+			Expect(egressCounter.Value()).To(BeNumerically("==", 1))
+		})
+	})
+})
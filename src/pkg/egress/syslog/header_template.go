@@ -0,0 +1,104 @@
+package syslog
+
+import (
+	"strings"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+)
+
+// headerTemplate renders a syslog header field from an envelope. Tags are
+// referenced by their name in curly braces, e.g. "{app_name}-{instance_index}".
+// "{source_id}" and "{instance_id}" refer to the fields of the envelope unless
+// a tag with that name exists. Unknown tags render as empty strings.
+type headerTemplate []templatePart
+
+type templatePart struct {
+	literal string
+	tag     string
+}
+
+func parseHeaderTemplate(s string) headerTemplate {
+	var t headerTemplate
+	for s != "" {
+		start := strings.IndexByte(s, '{')
+		end := strings.IndexByte(s[max(start, 0):], '}') + max(start, 0)
+		if start < 0 || end < start {
+			t = append(t, templatePart{literal: s})
+			break
+		}
+		if start > 0 {
+			t = append(t, templatePart{literal: s[:start]})
+		}
+		t = append(t, templatePart{tag: s[start+1 : end]})
+		s = s[end+1:]
+	}
+	return t
+}
+
+func (t headerTemplate) render(env *loggregator_v2.Envelope) string {
+	var b strings.Builder
+	for _, p := range t {
+		if p.tag == "" {
+			b.WriteString(p.literal)
+			continue
+		}
+		b.WriteString(templateValue(env, p.tag))
+	}
+	return b.String()
+}
+
+func templateValue(env *loggregator_v2.Envelope, tag string) string {
+	if v, ok := env.GetTags()[tag]; ok {
+		return v
+	}
+	switch tag {
+	case "source_id":
+		return env.GetSourceId()
+	case "instance_id":
+		return env.GetInstanceId()
+	}
+	return ""
+}
+
+// WithHostnameTemplate sets the template for the HOSTNAME of messages. The
+// rendered hostname is sanitized label by label. Envelopes for which the
+// template renders an empty hostname fall back to the hostname built from the
+// organization, space and app name.
+func WithHostnameTemplate(t string) ConverterOption {
+	return func(c *Converter) {
+		c.hostnameTemplate = parseHeaderTemplate(t)
+	}
+}
+
+// WithAppNameTemplate sets the template for the APP-NAME of messages, which
+// defaults to the source ID. Envelopes for which the template renders an
+// empty app name use the source ID.
+func WithAppNameTemplate(t string) ConverterOption {
+	return func(c *Converter) {
+		c.appNameTemplate = parseHeaderTemplate(t)
+	}
+}
+
+func (c *Converter) templatedHostname(env *loggregator_v2.Envelope) string {
+	labels := strings.Split(c.hostnameTemplate.render(env), ".")
+	sanitized := labels[:0]
+	for _, l := range labels {
+		if l = c.truncate(c.sanitizeHostname(l), 63); l != "" {
+			sanitized = append(sanitized, l)
+		}
+	}
+	return strings.Join(sanitized, ".")
+}
+
+// BuildAppName returns the APP-NAME of messages for the envelope.
+func (c *Converter) BuildAppName(env *loggregator_v2.Envelope) string {
+	if c.appNameTemplate == nil {
+		return env.GetSourceId()
+	}
+
+	appName := c.sanitizeProcID(c.appNameTemplate.render(env))
+	if appName == "" {
+		return env.GetSourceId()
+	}
+	return appName
+}
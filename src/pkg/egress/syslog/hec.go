@@ -0,0 +1,131 @@
+package syslog
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"strconv"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+)
+
+const hecEventPath = "/services/collector/event"
+
+// HECConverter serializes envelopes as Splunk HTTP Event Collector events.
+// Logs become events with the payload as string, all other envelopes become
+// events with a JSON object describing the metric.
+type HECConverter struct {
+	*Converter
+	index string
+}
+
+func NewHECConverter(index string, opts ...ConverterOption) *HECConverter {
+	return &HECConverter{
+		Converter: NewConverter(opts...),
+		index:     index,
+	}
+}
+
+type hecEvent struct {
+	Time       json.Number       `json:"time"`
+	Host       string            `json:"host"`
+	Source     string            `json:"source"`
+	SourceType string            `json:"sourcetype"`
+	Index      string            `json:"index,omitempty"`
+	Event      any               `json:"event"`
+	Fields     map[string]string `json:"fields"`
+}
+
+func (c *HECConverter) Convert(env *loggregator_v2.Envelope, defaultHostname string) ([][]byte, error) {
+	return singleMessage(c.ToHEC(env, defaultHostname))
+}
+
+// ToHEC returns the envelope as a newline terminated HEC event.
+func (c *HECConverter) ToHEC(env *loggregator_v2.Envelope, defaultHostname string) ([]byte, error) {
+	ev := hecEvent{
+		Time:   json.Number(strconv.FormatFloat(float64(env.GetTimestamp())/1e9, 'f', 3, 64)),
+		Host:   c.BuildHostname(env, defaultHostname),
+		Source: env.GetSourceId(),
+		Index:  c.index,
+		Fields: map[string]string{"instance_id": env.GetInstanceId()},
+	}
+	if !c.omitTags {
+		for k, v := range env.GetTags() {
+			ev.Fields[k] = v
+		}
+	}
+
+	switch m := env.GetMessage().(type) {
+	case *loggregator_v2.Envelope_Log:
+		ev.SourceType = "cf:logmessage"
+		ev.Fields["log_type"] = m.Log.GetType().String()
+		ev.Event = string(m.Log.GetPayload())
+	case *loggregator_v2.Envelope_Gauge:
+		ev.SourceType = "cf:gauge"
+		ev.Event = newJSONMetric(env)
+	case *loggregator_v2.Envelope_Counter:
+		ev.SourceType = "cf:counter"
+		ev.Event = newJSONMetric(env)
+	case *loggregator_v2.Envelope_Timer:
+		ev.SourceType = "cf:timer"
+		ev.Event = newJSONMetric(env)
+	case *loggregator_v2.Envelope_Event:
+		ev.SourceType = "cf:event"
+		ev.Event = newJSONMetric(env)
+	default:
+		return nil, nil
+	}
+
+	msg, err := json.Marshal(ev)
+	if err != nil {
+		return nil, err
+	}
+	return append(msg, '\n'), nil
+}
+
+// NewSplunkHECWriter returns an HTTPSBatchWriter that sends batches of HEC
+// events to a Splunk HTTP Event Collector. The HEC token is taken from the
+// password of the binding credentials or else of the drain URL, each falling
+// back to the username if there is no password. An authorization header set
+// with the header-authorization URL parameter replaces the token. The token
+// is removed from the URL, so that it is not part of logs and metrics. The
+// events are sent to /services/collector/event unless the URL has a path. An
+// index can be selected with the index URL parameter.
+func NewSplunkHECWriter(
+	binding *URLBinding,
+	netConf NetworkTimeoutConfig,
+	tlsConf *tls.Config,
+	egressMetric metrics.Counter,
+	opts []ConverterOption,
+	options ...Option,
+) egress.WriteCloser {
+	hecBinding := *binding
+	u := *binding.URL
+	hecBinding.URL = &u
+
+	token := binding.Password
+	if token == "" {
+		token = binding.Username
+	}
+	if u.User != nil {
+		if token == "" {
+			token = u.User.Username()
+			if p, ok := u.User.Password(); ok {
+				token = p
+			}
+		}
+		u.User = nil
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = hecEventPath
+	}
+	if token != "" {
+		hecBinding.Headers = append([]Header{{Name: "Authorization", Value: "Splunk " + token}}, binding.Headers...)
+	}
+
+	c := NewHECConverter(u.Query().Get("index"), opts...)
+	options = append(options, withContentType(jsonContentType))
+
+	return NewHTTPSBatchWriter(&hecBinding, netConf, tlsConf, egressMetric, c, options...)
+}
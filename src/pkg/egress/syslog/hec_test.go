@@ -0,0 +1,194 @@
+package syslog_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("HEC", func() {
+	Describe("HECConverter", func() {
+		It("converts a log envelope to a HEC event", func() {
+			c := syslog.NewHECConverter("")
+			env := buildLogEnvelope("APP", "2", "just a \"test\"", loggregator_v2.Log_ERR)
+
+			msg, err := c.ToHEC(env, "test-hostname")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(msg).To(HaveSuffix("\n"))
+			Expect(msg).To(MatchJSON(`{
+				"time": 0.012,
+				"host": "test-hostname",
+				"source": "test-app-id",
+				"sourcetype": "cf:logmessage",
+				"event": "just a \"test\"",
+				"fields": {"instance_id": "2", "source_type": "APP", "log_type": "ERR"}
+			}`))
+		})
+
+		DescribeTable("sets the sourcetype of the envelope type",
+			func(env *loggregator_v2.Envelope, sourceType string) {
+				msg, err := syslog.NewHECConverter("").ToHEC(env, "test-hostname")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(msg)).To(ContainSubstring(`"sourcetype":"` + sourceType + `"`))
+			},
+			Entry("gauge", buildGaugeEnvelope("1"), "cf:gauge"),
+			Entry("counter", buildCounterEnvelope("1"), "cf:counter"),
+			Entry("timer", buildTimerEnvelope("1"), "cf:timer"),
+			Entry("event", buildEventEnvelope("1"), "cf:event"),
+		)
+
+		It("wraps metrics in the event", func() {
+			c := syslog.NewHECConverter("main")
+
+			Expect(c.ToHEC(buildCounterEnvelope("1"), "test-hostname")).To(MatchJSON(`{
+				"time": 0.012,
+				"host": "test-hostname",
+				"source": "test-app-id",
+				"sourcetype": "cf:counter",
+				"index": "main",
+				"event": {"counter": {"name": "some-counter", "total": 99, "delta": 1}},
+				"fields": {"instance_id": "1"}
+			}`))
+		})
+
+		It("keeps the log type field if the tags are omitted", func() {
+			c := syslog.NewHECConverter("", syslog.WithoutSyslogMetadata())
+			env := buildLogEnvelope("APP", "2", "msg", loggregator_v2.Log_OUT)
+
+			Expect(c.ToHEC(env, "test-hostname")).To(MatchJSON(`{
+				"time": 0.012,
+				"host": "test-hostname",
+				"source": "test-app-id",
+				"sourcetype": "cf:logmessage",
+				"event": "msg",
+				"fields": {"instance_id": "2", "log_type": "OUT"}
+			}`))
+		})
+	})
+
+	Describe("NewSplunkHECWriter", func() {
+		var drain *rawDrain
+
+		BeforeEach(func() {
+			drain = newRawMockDrain(http.StatusOK)
+			DeferCleanup(drain.Close)
+		})
+
+		newWriter := func(b *syslog.URLBinding) egress.WriteCloser {
+			return syslog.NewSplunkHECWriter(
+				b,
+				syslog.NetworkTimeoutConfig{},
+				&tls.Config{InsecureSkipVerify: true}, //nolint:gosec
+				&metricsHelpers.SpyMetric{},
+				nil,
+				syslog.WithSendInterval(50*time.Millisecond),
+			)
+		}
+
+		It("sends batches of events to the event collector", func() {
+			b := buildURLBinding(drain.URL+"?index=main", "test-app-id", "test-hostname")
+			b.URL.Scheme = "splunk-hec"
+			b.URL.User = url.UserPassword("x", "some-token")
+
+			writer := newWriter(b)
+			defer writer.Close()
+
+			Expect(writer.Write(buildLogEnvelope("APP", "1", "message 1", loggregator_v2.Log_OUT))).To(Succeed())
+			Expect(writer.Write(buildLogEnvelope("APP", "2", "message 2", loggregator_v2.Log_OUT))).To(Succeed())
+
+			Eventually(drain.getBodies).Should(HaveLen(1))
+			r := drain.getRequests()[0]
+			Expect(r.URL.Path).To(Equal("/services/collector/event"))
+			Expect(r.Header.Get("Authorization")).To(Equal("Splunk some-token"))
+			Expect(r.Header.Get("Content-Type")).To(Equal("application/json"))
+
+			events := bytes.Split(bytes.TrimSuffix(drain.getBodies()[0], []byte("\n")), []byte("\n"))
+			Expect(events).To(HaveLen(2))
+			Expect(events[0]).To(MatchJSON(`{
+				"time": 0.012,
+				"host": "test-hostname",
+				"source": "test-app-id",
+				"sourcetype": "cf:logmessage",
+				"index": "main",
+				"event": "message 1",
+				"fields": {"instance_id": "1", "source_type": "APP", "log_type": "OUT"}
+			}`))
+		})
+
+		It("prefers the binding credentials as token", func() {
+			b := buildURLBinding(drain.URL, "test-app-id", "test-hostname")
+			b.URL.Scheme = "splunk-hec"
+			b.URL.User = url.UserPassword("x", "url-token")
+			b.Username = "x"
+			b.Password = "binding-token"
+
+			writer := newWriter(b)
+			defer writer.Close()
+
+			Expect(writer.Write(buildLogEnvelope("APP", "1", "message", loggregator_v2.Log_OUT))).To(Succeed())
+			Eventually(drain.getRequests).Should(HaveLen(1))
+			Expect(drain.getRequests()[0].Header.Get("Authorization")).To(Equal("Splunk binding-token"))
+		})
+
+		It("lets the authorization header replace the token", func() {
+			b := buildURLBinding(drain.URL, "test-app-id", "test-hostname")
+			b.URL.Scheme = "splunk-hec"
+			b.URL.User = url.User("url-token")
+			b.Headers = []syslog.Header{{Name: "Authorization", Value: "Splunk header-token"}}
+
+			writer := newWriter(b)
+			defer writer.Close()
+
+			Expect(writer.Write(buildLogEnvelope("APP", "1", "message", loggregator_v2.Log_OUT))).To(Succeed())
+			Eventually(drain.getRequests).Should(HaveLen(1))
+			Expect(drain.getRequests()[0].Header.Get("Authorization")).To(Equal("Splunk header-token"))
+		})
+
+		It("does not leak the token into logs and metrics", func() {
+			logBuffer := gbytes.NewBuffer()
+			log.SetOutput(logBuffer)
+			DeferCleanup(log.SetOutput, GinkgoWriter)
+
+			drain.setStatus(http.StatusServiceUnavailable)
+			u, err := url.Parse(drain.URL)
+			Expect(err).ToNot(HaveOccurred())
+			u.Scheme = "splunk-hec"
+			u.User = url.UserPassword("x", "some-token")
+			u.RawQuery = "index=main"
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			sm := metricsHelpers.NewMetricsRegistry()
+			f := syslog.NewWriterFactory(&tls.Config{}, &tls.Config{InsecureSkipVerify: true}, syslog.NetworkTimeoutConfig{}, sm) //nolint:gosec
+			writer, err := f.NewWriter(&syslog.URLBinding{URL: u, AppID: "app-id", Hostname: "test-hostname", Context: ctx}, nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(writer.Write(buildLogEnvelope("APP", "1", "message", loggregator_v2.Log_OUT))).To(Succeed())
+			Eventually(logBuffer, 5*time.Second).Should(gbytes.Say("Failed to write to"))
+			cancel()
+			Expect(writer.Close()).To(Succeed())
+
+			Expect(string(logBuffer.Contents())).ToNot(ContainSubstring("some-token"))
+			Expect(sm.HasMetric("egress", map[string]string{
+				"direction":   "egress",
+				"drain_scope": "app",
+				"drain_url":   "splunk-hec://" + u.Host,
+			})).To(BeTrue())
+			for name := range sm.Metrics {
+				Expect(name).ToNot(ContainSubstring("some-token"))
+			}
+		})
+	})
+})
@@ -2,7 +2,6 @@ package syslog
 
 import (
 	"crypto/tls"
-	"errors"
 	"fmt"
 	"log"
 	"net/url"
@@ -21,7 +20,10 @@ type HTTPSWriter struct {
 	url             *url.URL
 	client          *fasthttp.Client
 	egressMetric    metrics.Counter
-	syslogConverter *Converter
+	syslogConverter MessageConverter
+	contentType     string
+	contentEncoding string
+	headers         []Header
 }
 
 func NewHTTPSWriter(
@@ -29,7 +31,7 @@ func NewHTTPSWriter(
 	netConf NetworkTimeoutConfig,
 	tlsConf *tls.Config,
 	egressMetric metrics.Counter,
-	c *Converter,
+	c MessageConverter,
 ) egress.WriteCloser {
 
 	client := httpClient(netConf, tlsConf)
@@ -40,14 +42,33 @@ func NewHTTPSWriter(
 		client:          client,
 		egressMetric:    egressMetric,
 		syslogConverter: c,
+		contentType:     contentType(binding.Format, jsonContentType),
+		headers:         binding.Headers,
 	}
 }
 
 func (w *HTTPSWriter) sendHttpRequest(msg []byte, msgCount float64) error {
+	if err := w.post(msg, nil); err != nil {
+		return err
+	}
+	w.egressMetric.Add(msgCount)
+
+	return nil
+}
+
+// post sends msg to the drain. The body of a successful response is passed
+// to handleResponse, if set, before the response is released.
+func (w *HTTPSWriter) post(msg []byte, handleResponse func(body []byte)) error {
 	req := fasthttp.AcquireRequest()
 	req.SetRequestURI(w.url.String())
 	req.Header.SetMethod("POST")
-	req.Header.SetContentType("text/plain")
+	for _, h := range w.headers {
+		req.Header.Set(h.Name, h.Value)
+	}
+	req.Header.SetContentType(w.contentType)
+	if w.contentEncoding != "" {
+		req.Header.Set("Content-Encoding", w.contentEncoding)
+	}
 	req.SetBody(msg)
 
 	resp := fasthttp.AcquireResponse()
@@ -63,13 +84,15 @@ func (w *HTTPSWriter) sendHttpRequest(msg []byte, msgCount float64) error {
 		return fmt.Errorf("syslog Writer: Post responded with %d status code", resp.StatusCode())
 	}
 
-	w.egressMetric.Add(msgCount)
+	if handleResponse != nil {
+		handleResponse(resp.Body())
+	}
 
 	return nil
 }
 
 func (w *HTTPSWriter) Write(env *loggregator_v2.Envelope) error {
-	msgs, err := w.syslogConverter.ToRFC5424(env, w.hostname)
+	msgs, err := w.syslogConverter.Convert(env, w.hostname)
 	if err != nil {
 		log.Printf("failed to parse syslog, dropping faulty message, err: %s", err)
 		return nil
@@ -85,25 +108,61 @@ func (w *HTTPSWriter) Write(env *loggregator_v2.Envelope) error {
 	return nil
 }
 
-func (*HTTPSWriter) sanitizeError(u *url.URL, err error) error {
-	if u == nil || u.User == nil {
-		return err
+// sanitizeError redacts the header values and the userinfo of u from the
+// message of err.
+func (w *HTTPSWriter) sanitizeError(u *url.URL, err error) error {
+	secrets := make([]string, 0, len(w.headers)+2)
+	for _, h := range w.headers {
+		secrets = append(secrets, h.Value)
 	}
-
-	if user := u.User.Username(); user != "" {
-		err = errors.New(strings.ReplaceAll(err.Error(), user, "<REDACTED>"))
+	if u != nil && u.User != nil {
+		secrets = append(secrets, u.User.Username())
+		if p, ok := u.User.Password(); ok {
+			secrets = append(secrets, p)
+		}
 	}
 
-	if p, ok := u.User.Password(); ok {
-		err = errors.New(strings.ReplaceAll(err.Error(), p, "<REDACTED>"))
+	msg := err.Error()
+	for _, s := range secrets {
+		if s != "" {
+			msg = strings.ReplaceAll(msg, s, "<REDACTED>")
+		}
+	}
+	if msg == err.Error() {
+		return err
 	}
-	return err
+	return &sanitizedError{msg: msg, err: err}
+}
+
+// sanitizedError is an error whose message has secrets redacted. It still
+// wraps the original error so that it can be inspected with errors.Is and
+// errors.As.
+type sanitizedError struct {
+	msg string
+	err error
+}
+
+func (e *sanitizedError) Error() string {
+	return e.msg
+}
+
+func (e *sanitizedError) Unwrap() error {
+	return e.err
 }
 
 func (*HTTPSWriter) Close() error {
 	return nil
 }
 
+// contentType returns the content type of request bodies for the given
+// format. jsonType differs between single envelope and batched requests.
+func contentType(f Format, jsonType string) string {
+	if f == FormatJSON {
+		return jsonType
+	}
+	return "text/plain"
+}
+
 func httpClient(_ NetworkTimeoutConfig, tlsConf *tls.Config) *fasthttp.Client {
 	return &fasthttp.Client{
 		MaxConnsPerHost:     5,
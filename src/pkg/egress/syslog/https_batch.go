@@ -3,6 +3,8 @@ package syslog
 import (
 	"bytes"
 	"crypto/tls"
+	"errors"
+	"fmt"
 	"log"
 	"net/url"
 	"sync"
@@ -115,19 +117,46 @@ func NewRetryer(
 
 // Retry will retry the provided function up to maxRetries times.
 // It returns true if the function failed after all retries, false otherwise.
-// nolint:gosec
 func (r *Retryer) Retry(batch []byte, msgCount float64, funcToRetry func([]byte, float64) error) (failed bool) {
+	_, err := r.retryRejected(batch, msgCount, func(batch []byte, msgCount float64) ([]byte, float64, error) {
+		if err := funcToRetry(batch, msgCount); err != nil {
+			return batch, msgCount, err
+		}
+		return nil, 0, nil
+	})
+	return err != nil
+}
+
+// errCircuitOpen is returned by retryRejected if the circuit breaker of the
+// drain dropped the pending messages.
+var errCircuitOpen = errors.New("circuit breaker is open")
+
+// retryRejected is like Retry but funcToRetry returns the messages of the
+// batch that were not delivered, and only those are retried and charged to
+// the circuit breaker. It returns the number of messages that were not
+// delivered and the reason, which is errCircuitOpen if the circuit breaker
+// dropped them.
+// nolint:gosec
+func (r *Retryer) retryRejected(batch []byte, msgCount float64, funcToRetry func([]byte, float64) ([]byte, float64, error)) (float64, error) {
 	var err error
 
+	cb := r.binding.CircuitBreaker
+	if !cb.Allow(msgCount) {
+		r.logCircuitOpen(msgCount)
+		return msgCount, errCircuitOpen
+	}
+
 	// First attempt (fast path, not counted as a retry)
-	err = funcToRetry(batch, msgCount)
+	batch, msgCount, err = funcToRetry(batch, msgCount)
 	if err == nil {
-		return false
+		cb.Success()
+		return 0, nil
 	}
+	cb.Failure()
 
 	if egress.ContextDone(r.binding.Context) {
 		log.Printf("Context cancelled for %s for application %s, aborting retries", redactedURL(r.binding.URL).String(), r.binding.AppID)
-		return true
+		return msgCount, err
 	}
 
 	log.Printf("Failed to write to %s for application %s, retrying in %s, err: %s", redactedURL(r.binding.URL).String(), r.binding.AppID, r.retryDuration(0), err)
@@ -136,7 +165,12 @@ func (r *Retryer) Retry(batch []byte, msgCount float64, funcToRetry func([]byte,
 
 		if egress.ContextDone(r.binding.Context) {
 			log.Printf("Context cancelled for %s for application %s, aborting retries", redactedURL(r.binding.URL).String(), r.binding.AppID)
-			return true
+			return msgCount, err
+		}
+
+		if !cb.Allow(msgCount) {
+			r.logCircuitOpen(msgCount)
+			return msgCount, errCircuitOpen
 		}
 
 		sleepDuration := r.retryDuration(i)
@@ -145,18 +179,25 @@ func (r *Retryer) Retry(batch []byte, msgCount float64, funcToRetry func([]byte,
 		r.coordinator.Acquire(redactedURL(r.binding.URL).String(), r.binding.AppID)
 		func() {
 			defer r.coordinator.Release()
-			err = funcToRetry(batch, msgCount)
+			batch, msgCount, err = funcToRetry(batch, msgCount)
 		}()
 		if err == nil {
-			return false
+			cb.Success()
+			return 0, nil
 		}
+		cb.Failure()
 		log.Printf("Failed to write to %s for application %s, retrying in %s, err: %s", redactedURL(r.binding.URL).String(), r.binding.AppID, r.retryDuration(i+1), err)
 
 	}
 
 	log.Printf("Exhausted retries for %s for application %s, dropping batch with %.0f messages, err: %s",
 		redactedURL(r.binding.URL).String(), r.binding.AppID, msgCount, err)
-	return true
+	return msgCount, err
+}
+
+func (r *Retryer) logCircuitOpen(msgCount float64) {
+	log.Printf("Circuit breaker for %s for application %s is open, dropping batch with %.0f messages", //nolint:gosec
+		redactedURL(r.binding.URL).String(), r.binding.AppID, msgCount)
 }
 
 // --- HTTPSBatchWriter definition ---
@@ -169,6 +210,17 @@ type HTTPSBatchWriter struct {
 	msgChan      chan []byte
 	quit         chan struct{}
 	wg           sync.WaitGroup
+
+	encodeBatch       func([]byte) ([]byte, error)
+	rejectedMessages  func(batch, resp []byte) (rejected []byte, rejectedCount, dropped float64, err error)
+	compression       Compression
+	compressor        *compressor
+	uncompressedBytes metrics.Counter
+	compressedBytes   metrics.Counter
+
+	spool         *drainSpool
+	replayAttempt int
+	nextReplay    time.Time
 }
 
 // Also Marks that HTTPSBatchWriter implements the InternalRetryWriter interface
@@ -191,6 +243,57 @@ func WithSendInterval(interval time.Duration) Option {
 	}
 }
 
+// withContentType overrides the content type derived from the format of the
+// binding.
+func withContentType(ct string) Option {
+	return func(w *HTTPSBatchWriter) {
+		w.contentType = ct
+	}
+}
+
+// withBatchEncoder transforms every batch of converted messages into the
+// request body expected by the drain before it is compressed.
+func withBatchEncoder(encode func([]byte) ([]byte, error)) Option {
+	return func(w *HTTPSBatchWriter) {
+		w.encodeBatch = encode
+	}
+}
+
+// withRejectedMessages handles drains that accept part of a batch. For the
+// response to a batch, rejected returns the messages that should be sent
+// again and their number, as well as the number of messages that were
+// rejected permanently and are dropped. If it returns an error, the whole
+// batch failed.
+func withRejectedMessages(rejected func(batch, resp []byte) ([]byte, float64, float64, error)) Option {
+	return func(w *HTTPSBatchWriter) {
+		w.rejectedMessages = rejected
+	}
+}
+
+// WithCompression compresses every batch before it is sent and records the
+// size of delivered batches before and after compression.
+func WithCompression(c Compression, uncompressedBytes, compressedBytes metrics.Counter) Option {
+	return func(w *HTTPSBatchWriter) {
+		w.compression = c
+		w.uncompressedBytes = uncompressedBytes
+		w.compressedBytes = compressedBytes
+	}
+}
+
+// WithSpool persists batches that fail to send in the spool and replays
+// them in order once the drain accepts requests again. Spooled batches are
+// not retried by the Retryer.
+func WithSpool(s *Spool, key string, batchesMetric, bytesMetric metrics.Gauge) Option {
+	return func(w *HTTPSBatchWriter) {
+		ds, err := s.open(key, batchesMetric, bytesMetric)
+		if err != nil {
+			log.Printf("Failed to open spool for %s, failed batches will not be spooled, err: %s", redactedURL(w.url), err)
+			return
+		}
+		w.spool = ds
+	}
+}
+
 // HTTPSBatchWriter is an egress.WriteCloser implementation that batches syslog messages
 // and sends them via HTTPS in configurable batch sizes and intervals. It provides
 // backpressure to upstream callers by using a blocking channel for incoming messages.
@@ -203,7 +306,7 @@ func NewHTTPSBatchWriter(
 	netConf NetworkTimeoutConfig,
 	tlsConf *tls.Config,
 	egressMetric metrics.Counter,
-	c *Converter,
+	c MessageConverter,
 	options ...Option,
 ) egress.WriteCloser {
 	client := httpBatchClient(netConf, tlsConf)
@@ -217,6 +320,8 @@ func NewHTTPSBatchWriter(
 			client:          client,
 			egressMetric:    egressMetric,
 			syslogConverter: c,
+			contentType:     contentType(binding.Format, ndjsonContentType),
+			headers:         binding.Headers,
 		},
 		retryer:      *NewRetryer(binding, ExponentialDuration, 0), // Will be set by ConfigureRetry later
 		batchSize:    512 * 1024,                                   // Default value
@@ -229,6 +334,16 @@ func NewHTTPSBatchWriter(
 		opt(writer)
 	}
 
+	if writer.compression != NoCompression {
+		comp, err := newCompressor(writer.compression)
+		if err != nil {
+			log.Printf("Failed to create compressor for %s, sending uncompressed batches, err: %s", redactedURL(writer.url), err)
+		} else {
+			writer.compressor = comp
+			writer.contentEncoding = writer.compression.contentEncoding()
+		}
+	}
+
 	writer.wg.Add(1)
 	go writer.startSender()
 
@@ -236,7 +351,7 @@ func NewHTTPSBatchWriter(
 }
 
 func (w *HTTPSBatchWriter) Write(env *loggregator_v2.Envelope) error {
-	msgs, err := w.syslogConverter.ToRFC5424(env, w.hostname)
+	msgs, err := w.syslogConverter.Convert(env, w.hostname)
 	if err != nil {
 		log.Printf("Failed to parse syslog, dropping message, err: %s", err)
 		return nil
@@ -260,10 +375,10 @@ func (w *HTTPSBatchWriter) startSender() {
 
 	sendBatch := func() {
 		if msgBatch.Len() > 0 {
-			failed := w.retryer.Retry(msgBatch.Bytes(), msgCount, w.sendHttpRequest)
-			if failed {
-				log.Printf("Failed to deliver %.0f messages to %s for application %s after all retries, dropping batch", //nolint:gosec
-					msgCount, redactedURL(w.url), w.appID)
+			if w.spool != nil {
+				w.sendOrSpool(msgBatch.Bytes(), msgCount)
+			} else {
+				w.sendWithRetries(msgBatch.Bytes(), msgCount)
 			}
 			msgBatch.Reset()
 			msgCount = 0
@@ -286,6 +401,9 @@ func (w *HTTPSBatchWriter) startSender() {
 			}
 		case <-ticker.C:
 			sendBatch()
+			if w.spool != nil {
+				w.replaySpool()
+			}
 		case <-w.quit:
 			sendBatch()
 			return
@@ -293,9 +411,184 @@ func (w *HTTPSBatchWriter) startSender() {
 	}
 }
 
+func (w *HTTPSBatchWriter) sendWithRetries(batch []byte, msgCount float64) {
+	// Only the messages rejected by the previous attempt are sent again. The
+	// request body is built once and only rebuilt if the drain accepted part
+	// of the batch.
+	var encoded, body []byte
+	undelivered, err := w.retryer.retryRejected(batch, msgCount, func(pending []byte, pendingCount float64) ([]byte, float64, error) {
+		if body == nil {
+			var err error
+			encoded, body, err = w.body(pending)
+			if err != nil {
+				return pending, pendingCount, err
+			}
+		}
+		rejected, rejectedCount, err := w.sendBody(pending, pendingCount, encoded, body)
+		if rejectedCount != pendingCount {
+			encoded, body = nil, nil
+		}
+		return rejected, rejectedCount, err
+	})
+	// The retryer already logged the messages dropped by the circuit breaker.
+	if err != nil && !errors.Is(err, errCircuitOpen) {
+		log.Printf("Failed to deliver %.0f messages to %s for application %s after all retries, dropping batch", //nolint:gosec
+			undelivered, redactedURL(w.url), w.appID)
+	}
+}
+
+// sendOrSpool sends the batch once and spools the messages that were not
+// delivered. While older batches are waiting to be replayed, the batch is
+// spooled right away so that the drain receives all batches in order.
+func (w *HTTPSBatchWriter) sendOrSpool(batch []byte, msgCount float64) {
+	if w.spool.len() == 0 {
+		rejected, rejectedCount, err := w.send(batch, msgCount)
+		if err == nil {
+			return
+		}
+		log.Printf("Failed to write to %s for application %s, spooling batch with %.0f messages, err: %s", //nolint:gosec
+			redactedURL(w.url), w.appID, rejectedCount, err)
+		batch, msgCount = rejected, rejectedCount
+	}
+
+	if err := w.spool.push(batch, msgCount); err != nil {
+		log.Printf("Failed to spool batch for %s for application %s, dropping %.0f messages, err: %s", //nolint:gosec
+			redactedURL(w.url), w.appID, msgCount, err)
+	}
+}
+
+// replaySpool sends spooled batches, oldest first, until the spool is empty,
+// a send fails, or one send interval has passed. After a failure the replay
+// is delayed according to the retry duration.
+func (w *HTTPSBatchWriter) replaySpool() {
+	if w.spool.len() == 0 || time.Now().Before(w.nextReplay) {
+		return
+	}
+	if !w.spool.replayMu.TryLock() {
+		return
+	}
+	defer w.spool.replayMu.Unlock()
+
+	deadline := time.Now().Add(w.sendInterval)
+	for time.Now().Before(deadline) {
+		batch, msgCount, ok, err := w.spool.peek()
+		if !ok {
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to read spooled batch for %s for application %s, dropping it, err: %s", redactedURL(w.url), w.appID, err)
+			w.spool.pop()
+			continue
+		}
+
+		w.retryer.coordinator.Acquire(redactedURL(w.url).String(), w.appID)
+		rejected, rejectedCount, err := w.send(batch, msgCount)
+		w.retryer.coordinator.Release()
+		if err != nil {
+			if rejectedCount < msgCount {
+				// The drain accepted part of the batch. The rest is spooled
+				// again, drains that accept partial batches do not rely on
+				// the order of messages.
+				w.spool.pop()
+				if err := w.spool.push(rejected, rejectedCount); err != nil {
+					log.Printf("Failed to spool batch for %s for application %s, dropping %.0f messages, err: %s", //nolint:gosec
+						redactedURL(w.url), w.appID, rejectedCount, err)
+				}
+			}
+			retryIn := w.retryer.retryDuration(w.replayAttempt)
+			w.replayAttempt++
+			w.nextReplay = time.Now().Add(retryIn)
+			log.Printf("Failed to replay spooled batch to %s for application %s, retrying in %s, err: %s", redactedURL(w.url), w.appID, retryIn, err)
+			return
+		}
+		w.replayAttempt = 0
+		w.spool.pop()
+	}
+}
+
+// send sends the batch once. On failure it returns the messages that were
+// not delivered, which are only part of the batch if the drain rejected
+// single messages.
+func (w *HTTPSBatchWriter) send(batch []byte, msgCount float64) (rejected []byte, rejectedCount float64, err error) {
+	encoded, body, err := w.body(batch)
+	if err != nil {
+		return batch, msgCount, err
+	}
+	return w.sendBody(batch, msgCount, encoded, body)
+}
+
+// sendBody sends the request body built from the batch by body.
+func (w *HTTPSBatchWriter) sendBody(batch []byte, msgCount float64, encoded, body []byte) (rejected []byte, rejectedCount float64, err error) {
+	if w.rejectedMessages == nil {
+		if err := w.sendHttpRequest(body, msgCount); err != nil {
+			return batch, msgCount, err
+		}
+		w.countCompression(encoded, body)
+		return nil, 0, nil
+	}
+
+	var (
+		dropped     float64
+		responseErr error
+	)
+	err = w.post(body, func(resp []byte) {
+		rejected, rejectedCount, dropped, responseErr = w.rejectedMessages(batch, resp)
+	})
+	if err == nil {
+		err = responseErr
+	}
+	if err != nil {
+		return batch, msgCount, err
+	}
+	w.countCompression(encoded, body)
+	w.egressMetric.Add(msgCount - rejectedCount - dropped)
+
+	if rejectedCount > 0 {
+		return rejected, rejectedCount, fmt.Errorf("drain rejected %.0f of %.0f messages", rejectedCount, msgCount)
+	}
+	return nil, 0, nil
+}
+
+// body returns the encoded batch and the request body, which is the encoded
+// batch after compression.
+func (w *HTTPSBatchWriter) body(batch []byte) (encoded, body []byte, err error) {
+	if w.encodeBatch != nil {
+		batch, err = w.encodeBatch(batch)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if w.compressor == nil {
+		return batch, batch, nil
+	}
+
+	body, err = w.compressor.compress(batch)
+	if err != nil {
+		return nil, nil, err
+	}
+	return batch, body, nil
+}
+
+// countCompression records the size of a delivered request body before and
+// after compression. Failed attempts are not counted so that retries and
+// replays do not inflate the counters.
+func (w *HTTPSBatchWriter) countCompression(encoded, body []byte) {
+	if w.compressor == nil {
+		return
+	}
+	w.uncompressedBytes.Add(float64(len(encoded)))
+	w.compressedBytes.Add(float64(len(body)))
+}
+
 func (w *HTTPSBatchWriter) Close() error {
 	close(w.quit)
 	w.wg.Wait()
+	if w.spool != nil {
+		w.spool.spool.release(w.spool)
+	}
+	if w.compressor != nil {
+		return w.compressor.close()
+	}
 	return nil
 }
 
@@ -8,6 +8,7 @@ import (
 
 	"context"
 
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -86,6 +87,27 @@ var _ = Describe("Retryer", func() {
 		Eventually(retryAttempts, waitTime).Should(Equal(3))
 	})
 
+	It("stops retrying when the circuit breaker opens", func() {
+		dropped := &metricsHelpers.SpyMetric{}
+		binding.CircuitBreaker = syslog.NewCircuitBreaker(2, time.Minute, dropped, nil)
+
+		failed := retryer.Retry([]byte("test-batch"), 10, func(batch []byte, msgCount float64) error {
+			retryAttempts++
+			return errors.New("test error")
+		})
+
+		Expect(failed).To(BeTrue())
+		Expect(retryAttempts).To(Equal(2))
+		Expect(dropped.Value()).To(BeNumerically("==", 10))
+
+		retryer.Retry([]byte("test-batch"), 10, func(batch []byte, msgCount float64) error {
+			retryAttempts++
+			return nil
+		})
+		Expect(retryAttempts).To(Equal(2))
+		Expect(dropped.Value()).To(BeNumerically("==", 20))
+	})
+
 	It("respects the global parallel retry limit (locking behaviour)", func() {
 		syslog.WithParallelRetries(2)
 		coordinator := syslog.GetGlobalRetryCoordinator()
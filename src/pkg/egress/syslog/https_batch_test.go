@@ -2,8 +2,11 @@ package syslog_test
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"crypto/tls"
 	"io"
+	"log"
 	"net/http"
 	"net/http/httptest"
 	"time"
@@ -13,8 +16,10 @@ import (
 	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+	"github.com/klauspost/compress/zstd"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
 )
 
 var stringTo256Chars string
@@ -126,6 +131,139 @@ var _ = Describe("HTTPS_batch", func() {
 		Expect(drain.getRequestCount()).Should(BeNumerically("<=", 10))
 	})
 
+	It("sends newline delimited JSON for the JSON format", func() {
+		jsonDrain := newRawMockDrain(http.StatusOK)
+		b := buildURLBinding(jsonDrain.URL, "test-app-id", "test-hostname")
+		b.Format = syslog.FormatJSON
+		jsonWriter := syslog.NewHTTPSBatchWriter(
+			b,
+			netConf,
+			skipSSLTLSConfig,
+			&metricsHelpers.SpyMetric{},
+			syslog.NewJSONConverter(),
+			syslog.WithBatchSize(1000),
+			syslog.WithSendInterval(sendInterval),
+		)
+		defer jsonWriter.Close()
+
+		Expect(jsonWriter.Write(buildLogEnvelope("APP", "1", "message 1", loggregator_v2.Log_OUT))).To(Succeed())
+		Expect(jsonWriter.Write(buildCounterEnvelope("2"))).To(Succeed())
+		Eventually(jsonDrain.getBodies, sendInterval+waitTime).Should(HaveLen(1))
+
+		lines := bytes.Split(bytes.TrimSuffix(jsonDrain.getBodies()[0], []byte("\n")), []byte("\n"))
+		Expect(lines).To(HaveLen(2))
+		Expect(lines[0]).To(MatchJSON(`{"timestamp":"1970-01-01T00:00:00.012345678Z","source_id":"test-app-id","instance_id":"1","hostname":"test-hostname","tags":{"source_type":"APP"},"log":{"type":"OUT","payload":"message 1"}}`))
+		Expect(lines[1]).To(MatchJSON(`{"timestamp":"1970-01-01T00:00:00.012345678Z","source_id":"test-app-id","instance_id":"2","hostname":"test-hostname","counter":{"name":"some-counter","total":99,"delta":1}}`))
+		Expect(jsonDrain.headers[0]).To(HaveKeyWithValue("Content-Type", []string{"application/x-ndjson"}))
+	})
+
+	DescribeTable("compresses batches", func(compression syslog.Compression, encoding string, decompress func([]byte) []byte) {
+		rawDrain := newRawMockDrain(http.StatusOK)
+		b := buildURLBinding(rawDrain.URL, "test-app-id", "test-hostname")
+		uncompressedBytes := &metricsHelpers.SpyMetric{}
+		compressedBytes := &metricsHelpers.SpyMetric{}
+		compressingWriter := syslog.NewHTTPSBatchWriter(
+			b,
+			netConf,
+			skipSSLTLSConfig,
+			&metricsHelpers.SpyMetric{},
+			c,
+			syslog.WithBatchSize(1000),
+			syslog.WithSendInterval(sendInterval),
+			syslog.WithCompression(compression, uncompressedBytes, compressedBytes),
+		)
+		defer compressingWriter.Close()
+
+		env := buildLogEnvelope("APP", "1", "message 1", loggregator_v2.Log_OUT)
+		Expect(compressingWriter.Write(env)).To(Succeed())
+		Expect(compressingWriter.Write(env)).To(Succeed())
+		Eventually(rawDrain.getBodies, sendInterval+waitTime).Should(HaveLen(1))
+
+		expected, err := c.ToRFC5424(env, "test-hostname")
+		Expect(err).ToNot(HaveOccurred())
+		body := rawDrain.getBodies()[0]
+		Expect(string(decompress(body))).To(Equal(string(expected[0]) + string(expected[0])))
+		Expect(rawDrain.headers[0]).To(HaveKeyWithValue("Content-Encoding", []string{encoding}))
+		Eventually(uncompressedBytes.Value).Should(BeNumerically("==", 2*len(expected[0])))
+		Eventually(compressedBytes.Value).Should(BeNumerically("==", len(body)))
+	},
+		Entry("gzip", syslog.GzipCompression, "gzip", func(b []byte) []byte {
+			r, err := gzip.NewReader(bytes.NewReader(b))
+			Expect(err).ToNot(HaveOccurred())
+			out, err := io.ReadAll(r)
+			Expect(err).ToNot(HaveOccurred())
+			return out
+		}),
+		Entry("zstd", syslog.ZstdCompression, "zstd", func(b []byte) []byte {
+			d, err := zstd.NewReader(nil)
+			Expect(err).ToNot(HaveOccurred())
+			defer d.Close()
+			out, err := d.DecodeAll(b, nil)
+			Expect(err).ToNot(HaveOccurred())
+			return out
+		}),
+	)
+
+	It("counts the compressed size of delivered batches only", func() {
+		rawDrain := newRawMockDrain(http.StatusServiceUnavailable)
+		b := buildURLBinding(rawDrain.URL, "test-app-id", "test-hostname")
+		b.Context = context.Background()
+		uncompressedBytes := &metricsHelpers.SpyMetric{}
+		compressedBytes := &metricsHelpers.SpyMetric{}
+		compressingWriter := syslog.NewHTTPSBatchWriter(
+			b,
+			netConf,
+			skipSSLTLSConfig,
+			&metricsHelpers.SpyMetric{},
+			c,
+			syslog.WithBatchSize(1000),
+			syslog.WithSendInterval(sendInterval),
+			syslog.WithCompression(syslog.GzipCompression, uncompressedBytes, compressedBytes),
+		)
+		compressingWriter.(syslog.InternalRetryWriter).ConfigureRetry(func(int) time.Duration {
+			return 10 * time.Millisecond
+		}, 100)
+		defer compressingWriter.Close()
+
+		env := buildLogEnvelope("APP", "1", "message 1", loggregator_v2.Log_OUT)
+		Expect(compressingWriter.Write(env)).To(Succeed())
+		Eventually(rawDrain.getRequestCount, sendInterval+waitTime).Should(BeNumerically(">=", 3))
+		Expect(compressedBytes.Value()).To(BeZero())
+
+		rawDrain.setStatus(http.StatusOK)
+		Eventually(rawDrain.getBodies).Should(HaveLen(1))
+
+		expected, err := c.ToRFC5424(env, "test-hostname")
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(uncompressedBytes.Value).Should(BeNumerically("==", len(expected[0])))
+		Eventually(compressedBytes.Value).Should(BeNumerically("==", len(rawDrain.getBodies()[0])))
+	})
+
+	It("does not set a Content-Encoding without compression", func() {
+		env := buildLogEnvelope("APP", "1", "message 1", loggregator_v2.Log_OUT)
+		Expect(writer.Write(env)).To(Succeed())
+		Eventually(drain.getMessagesSize, sendInterval+waitTime).Should(Equal(1))
+		Expect(drain.headers[0]).ToNot(HaveKey("Content-Encoding"))
+	})
+
+	It("logs that the circuit breaker dropped a batch instead of exhausted retries", func() {
+		logBuffer := gbytes.NewBuffer()
+		log.SetOutput(logBuffer)
+		DeferCleanup(log.SetOutput, GinkgoWriter)
+
+		dropped := &metricsHelpers.SpyMetric{}
+		b.CircuitBreaker = syslog.NewCircuitBreaker(1, time.Hour, dropped, nil)
+		b.CircuitBreaker.Failure()
+
+		env := buildLogEnvelope("APP", "1", "message 1", loggregator_v2.Log_OUT)
+		Expect(writer.Write(env)).To(Succeed())
+
+		Eventually(logBuffer, waitTime).Should(gbytes.Say("Circuit breaker for .* is open, dropping batch with 1 messages"))
+		Expect(dropped.Value()).To(BeNumerically("==", 1))
+		Consistently(logBuffer, 2*sendInterval).ShouldNot(gbytes.Say("after all retries"))
+		Expect(drain.getMessagesSize()).To(BeZero())
+	})
+
 	It("test for hanging after some ticks", func() {
 		// This test will not succeed on the timer based implementation,
 		// it works fine with a ticker based implementation.
@@ -2,6 +2,7 @@ package syslog_test
 
 import (
 	"crypto/tls"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -110,6 +111,116 @@ var _ = Describe("HTTPWriter", func() {
 		Expect(drain.headers[0]).To(HaveKeyWithValue("Content-Type", []string{"text/plain"}))
 	})
 
+	It("sends JSON with Content-Type application/json for the JSON format", func() {
+		drain := newRawMockDrain(http.StatusOK)
+
+		b := buildURLBinding(
+			drain.URL,
+			"test-app-id",
+			"test-hostname",
+		)
+		b.Format = syslog.FormatJSON
+
+		writer := syslog.NewHTTPSWriter(
+			b,
+			netConf,
+			skipSSLTLSConfig,
+			&metricsHelpers.SpyMetric{},
+			syslog.NewJSONConverter(),
+		)
+
+		env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+		Expect(writer.Write(env)).To(Succeed())
+
+		Expect(drain.getBodies()).To(HaveLen(1))
+		Expect(drain.getBodies()[0]).To(MatchJSON(`{
+			"timestamp": "1970-01-01T00:00:00.012345678Z",
+			"source_id": "test-app-id",
+			"instance_id": "1",
+			"hostname": "test-hostname",
+			"tags": {"source_type": "APP"},
+			"log": {"type": "OUT", "payload": "just a test"}
+		}`))
+		Expect(drain.headers[0]).To(HaveKeyWithValue("Content-Type", []string{"application/json"}))
+	})
+
+	It("sends the headers of the binding", func() {
+		drain := newRawMockDrain(http.StatusOK)
+
+		b := buildURLBinding(
+			drain.URL,
+			"test-app-id",
+			"test-hostname",
+		)
+		b.Headers = []syslog.Header{
+			{Name: "Authorization", Value: "Bearer some-token"},
+			{Name: "X-Api-Key", Value: "some-key"},
+		}
+
+		writer := syslog.NewHTTPSWriter(
+			b,
+			netConf,
+			skipSSLTLSConfig,
+			&metricsHelpers.SpyMetric{},
+			c,
+		)
+
+		env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+		Expect(writer.Write(env)).To(Succeed())
+
+		Expect(drain.headers).To(HaveLen(1))
+		Expect(drain.headers[0]).To(HaveKeyWithValue("Authorization", []string{"Bearer some-token"}))
+		Expect(drain.headers[0]).To(HaveKeyWithValue("X-Api-Key", []string{"some-key"}))
+		Expect(drain.headers[0]).To(HaveKeyWithValue("Content-Type", []string{"text/plain"}))
+	})
+
+	It("does not leak header values when reporting a POST error", func() {
+		b := buildURLBinding(
+			"http://localhost:0",
+			"test-app-id",
+			"test-hostname",
+		)
+		b.Headers = []syslog.Header{{Name: "X-Api-Key", Value: "127.0.0.1"}}
+
+		writer := syslog.NewHTTPSWriter(
+			b,
+			netConf,
+			skipSSLTLSConfig,
+			&metricsHelpers.SpyMetric{},
+			c,
+		)
+
+		env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+		err := writer.Write(env)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).ToNot(ContainSubstring("127.0.0.1"))
+		Expect(err.Error()).To(ContainSubstring("<REDACTED>"))
+		Expect(errors.Unwrap(err)).To(MatchError(ContainSubstring("127.0.0.1")))
+	})
+
+	It("ignores empty header values when reporting a POST error", func() {
+		b := buildURLBinding(
+			"http://localhost:0",
+			"test-app-id",
+			"test-hostname",
+		)
+		b.Headers = []syslog.Header{{Name: "X-Api-Key", Value: ""}}
+
+		writer := syslog.NewHTTPSWriter(
+			b,
+			netConf,
+			skipSSLTLSConfig,
+			&metricsHelpers.SpyMetric{},
+			c,
+		)
+
+		env := buildLogEnvelope("APP", "1", "just a test", loggregator_v2.Log_OUT)
+		err := writer.Write(env)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("127.0.0.1"))
+		Expect(err.Error()).ToNot(ContainSubstring("<REDACTED>"))
+	})
+
 	It("writes gauge metrics to the http drain", func() {
 		drain := newMockOKDrain()
 
@@ -277,6 +388,8 @@ func (d *SpyDrain) getMessagesSize() int {
 }
 
 func (d *SpyDrain) getRequestCount() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	return d.requestCount
 }
 func newMockOKDrain() *SpyDrain {
@@ -306,6 +419,90 @@ func newMockDrain(status int) *SpyDrain {
 	return drain
 }
 
+// rawDrain records accepted requests and their bodies without parsing them.
+// The bodies of requests that fail are recorded as rejected.
+type rawDrain struct {
+	SpyDrain
+	requests  []*http.Request
+	bodies    [][]byte
+	rejected  [][]byte
+	status    int
+	failures  int
+	responses []string
+}
+
+func (d *rawDrain) setStatus(status int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.status = status
+}
+
+// failNext answers the next n requests with 503 Service Unavailable.
+func (d *rawDrain) failNext(n int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.failures = n
+}
+
+// respondWith sets the bodies of the responses to the next accepted requests.
+func (d *rawDrain) respondWith(bodies ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.responses = bodies
+}
+
+func (d *rawDrain) getRequests() []*http.Request {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.requests
+}
+
+func (d *rawDrain) getBodies() [][]byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.bodies
+}
+
+func (d *rawDrain) getRejected() [][]byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.rejected
+}
+
+func newRawMockDrain(status int) *rawDrain {
+	drain := &rawDrain{status: status}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		Expect(err).ToNot(HaveOccurred())
+		defer r.Body.Close()
+
+		drain.mu.Lock()
+		defer drain.mu.Unlock()
+		drain.requestCount++
+		status := drain.status
+		if drain.failures > 0 {
+			drain.failures--
+			status = http.StatusServiceUnavailable
+		}
+		if status >= 300 {
+			drain.rejected = append(drain.rejected, body)
+			w.WriteHeader(status)
+			return
+		}
+
+		drain.requests = append(drain.requests, r)
+		drain.bodies = append(drain.bodies, body)
+		drain.headers = append(drain.headers, r.Header)
+		w.WriteHeader(status)
+		if len(drain.responses) > 0 {
+			_, _ = w.Write([]byte(drain.responses[0]))
+			drain.responses = drain.responses[1:]
+		}
+	})
+	drain.Server = httptest.NewTLSServer(handler)
+	return drain
+}
+
 func buildURLBinding(u, appID, hostname string) *syslog.URLBinding {
 	parsedURL, _ := url.Parse(u)
 
@@ -0,0 +1,137 @@
+package syslog
+
+import (
+	"encoding/json"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+)
+
+const (
+	jsonContentType   = "application/json"
+	ndjsonContentType = "application/x-ndjson"
+)
+
+// JSONConverter serializes every envelope as a single line of JSON. Batches
+// of converted envelopes therefore form valid newline delimited JSON.
+type JSONConverter struct {
+	*Converter
+}
+
+func NewJSONConverter(opts ...ConverterOption) *JSONConverter {
+	return &JSONConverter{
+		Converter: NewConverter(opts...),
+	}
+}
+
+type jsonEnvelope struct {
+	Timestamp  string            `json:"timestamp"`
+	SourceID   string            `json:"source_id"`
+	InstanceID string            `json:"instance_id"`
+	Hostname   string            `json:"hostname"`
+	Tags       map[string]string `json:"tags,omitempty"`
+	Log        *jsonLog          `json:"log,omitempty"`
+	*jsonMetric
+	SampleRate float64 `json:"sample_rate,omitempty"`
+}
+
+type jsonLog struct {
+	Type    string `json:"type"`
+	Payload string `json:"payload"`
+}
+
+type jsonGaugeValue struct {
+	Unit  string  `json:"unit"`
+	Value float64 `json:"value"`
+}
+
+type jsonCounter struct {
+	Name  string `json:"name"`
+	Total uint64 `json:"total"`
+	Delta uint64 `json:"delta"`
+}
+
+type jsonTimer struct {
+	Name  string `json:"name"`
+	Start int64  `json:"start"`
+	Stop  int64  `json:"stop"`
+}
+
+type jsonEvent struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+func (c *JSONConverter) Convert(env *loggregator_v2.Envelope, defaultHostname string) ([][]byte, error) {
+	return singleMessage(c.ToJSON(env, defaultHostname))
+}
+
+// ToJSON returns the envelope as a newline terminated JSON object.
+func (c *JSONConverter) ToJSON(env *loggregator_v2.Envelope, defaultHostname string) ([]byte, error) {
+	je := jsonEnvelope{
+		Timestamp:  time.Unix(0, env.GetTimestamp()).UTC().Format(time.RFC3339Nano),
+		SourceID:   env.GetSourceId(),
+		InstanceID: env.GetInstanceId(),
+		Hostname:   c.BuildHostname(env, defaultHostname),
+		SampleRate: c.sampleRate,
+	}
+	if !c.omitTags && len(env.GetTags()) > 0 {
+		je.Tags = env.GetTags()
+	}
+
+	if l, ok := env.GetMessage().(*loggregator_v2.Envelope_Log); ok {
+		je.Log = &jsonLog{
+			Type:    l.Log.GetType().String(),
+			Payload: string(l.Log.GetPayload()),
+		}
+	} else if je.jsonMetric = newJSONMetric(env); je.jsonMetric == nil {
+		return nil, nil
+	}
+
+	msg, err := json.Marshal(je)
+	if err != nil {
+		return nil, err
+	}
+	return append(msg, '\n'), nil
+}
+
+// jsonMetric describes a non-log envelope for formats that embed it into
+// their own events.
+type jsonMetric struct {
+	Gauge   map[string]jsonGaugeValue `json:"gauge,omitempty"`
+	Counter *jsonCounter              `json:"counter,omitempty"`
+	Timer   *jsonTimer                `json:"timer,omitempty"`
+	Event   *jsonEvent                `json:"event,omitempty"`
+}
+
+// newJSONMetric returns nil for logs and envelopes without a supported
+// message type.
+func newJSONMetric(env *loggregator_v2.Envelope) *jsonMetric {
+	switch m := env.GetMessage().(type) {
+	case *loggregator_v2.Envelope_Gauge:
+		gauge := make(map[string]jsonGaugeValue, len(m.Gauge.GetMetrics()))
+		for name, g := range m.Gauge.GetMetrics() {
+			gauge[name] = jsonGaugeValue{Unit: g.GetUnit(), Value: g.GetValue()}
+		}
+		return &jsonMetric{Gauge: gauge}
+	case *loggregator_v2.Envelope_Counter:
+		return &jsonMetric{Counter: &jsonCounter{
+			Name:  m.Counter.GetName(),
+			Total: m.Counter.GetTotal(),
+			Delta: m.Counter.GetDelta(),
+		}}
+	case *loggregator_v2.Envelope_Timer:
+		return &jsonMetric{Timer: &jsonTimer{
+			Name:  m.Timer.GetName(),
+			Start: m.Timer.GetStart(),
+			Stop:  m.Timer.GetStop(),
+		}}
+	case *loggregator_v2.Envelope_Event:
+		return &jsonMetric{Event: &jsonEvent{
+			Title: m.Event.GetTitle(),
+			Body:  m.Event.GetBody(),
+		}}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,115 @@
+package syslog_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+)
+
+var _ = Describe("JSON", func() {
+	var (
+		c *syslog.JSONConverter
+	)
+
+	BeforeEach(func() {
+		c = syslog.NewJSONConverter()
+	})
+
+	It("converts a log envelope to a JSON line", func() {
+		env := buildLogEnvelope("APP", "2", "just a \"test\"\n", loggregator_v2.Log_ERR)
+
+		Expect(c.Convert(env, "test-hostname")).To(Equal([][]byte{
+			[]byte(`{"timestamp":"1970-01-01T00:00:00.012345678Z","source_id":"test-app-id","instance_id":"2","hostname":"test-hostname","tags":{"source_type":"APP"},"log":{"type":"ERR","payload":"just a \"test\"\n"}}` + "\n"),
+		}))
+	})
+
+	It("has the option to add the sample rate", func() {
+		c = syslog.NewJSONConverter(syslog.WithSampleRate(0.25))
+		env := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
+
+		Expect(c.Convert(env, "test-hostname")).To(Equal([][]byte{
+			[]byte(`{"timestamp":"1970-01-01T00:00:00.012345678Z","source_id":"test-app-id","instance_id":"2","hostname":"test-hostname","tags":{"source_type":"APP"},"log":{"type":"OUT","payload":"just a test"},"sample_rate":0.25}` + "\n"),
+		}))
+	})
+
+	It("converts a gauge envelope to a single JSON line", func() {
+		env := buildGaugeEnvelope("1")
+
+		msg, err := c.ToJSON(env, "test-hostname")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(msg).To(HaveSuffix("\n"))
+		Expect(msg).To(MatchJSON(`{
+			"timestamp": "1970-01-01T00:00:00.012345678Z",
+			"source_id": "test-app-id",
+			"instance_id": "1",
+			"hostname": "test-hostname",
+			"gauge": {
+				"cpu": {"unit": "percentage", "value": 0.23},
+				"disk": {"unit": "bytes", "value": 1234},
+				"disk_quota": {"unit": "bytes", "value": 1024},
+				"memory": {"unit": "bytes", "value": 5423},
+				"memory_quota": {"unit": "bytes", "value": 8000}
+			}
+		}`))
+	})
+
+	It("converts a counter envelope to a JSON line", func() {
+		env := buildCounterEnvelope("1")
+
+		Expect(c.ToJSON(env, "test-hostname")).To(MatchJSON(`{
+			"timestamp": "1970-01-01T00:00:00.012345678Z",
+			"source_id": "test-app-id",
+			"instance_id": "1",
+			"hostname": "test-hostname",
+			"counter": {"name": "some-counter", "total": 99, "delta": 1}
+		}`))
+	})
+
+	It("converts a timer envelope to a JSON line", func() {
+		env := buildTimerEnvelope("1")
+
+		Expect(c.ToJSON(env, "test-hostname")).To(MatchJSON(`{
+			"timestamp": "1970-01-01T00:00:00.012345678Z",
+			"source_id": "test-app-id",
+			"instance_id": "1",
+			"hostname": "test-hostname",
+			"timer": {"name": "http", "start": 10, "stop": 20}
+		}`))
+	})
+
+	It("converts an event envelope to a JSON line", func() {
+		env := buildEventEnvelope("1")
+
+		Expect(c.ToJSON(env, "test-hostname")).To(MatchJSON(`{
+			"timestamp": "1970-01-01T00:00:00.012345678Z",
+			"source_id": "test-app-id",
+			"instance_id": "1",
+			"hostname": "test-hostname",
+			"event": {"title": "event-title", "body": "event-body"}
+		}`))
+	})
+
+	It("builds the hostname from org, space, and app name tags", func() {
+		env := buildCounterEnvelope("1")
+		env.Tags = map[string]string{
+			"organization_name": "some-org",
+			"space_name":        "some-space",
+			"app_name":          "some-app",
+		}
+
+		msg, err := c.ToJSON(env, "test-hostname")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(msg)).To(ContainSubstring(`"hostname":"some-org.some-space.some-app"`))
+	})
+
+	It("has the option to omit tags", func() {
+		c = syslog.NewJSONConverter(syslog.WithoutSyslogMetadata())
+		env := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
+
+		msg, err := c.ToJSON(env, "test-hostname")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(msg)).ToNot(ContainSubstring("tags"))
+	})
+})
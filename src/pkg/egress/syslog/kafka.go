@@ -0,0 +1,213 @@
+package syslog
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+)
+
+const defaultKafkaPort = "9092"
+
+// KafkaWriter publishes messages to a Kafka topic. Messages are keyed and
+// partitioned by the source ID of their envelope, so that the messages of
+// an app stay in order. Messages are batched and retried by an idempotent
+// producer, so that retried batches are not duplicated.
+type KafkaWriter struct {
+	client *kgo.Client
+	ctx    context.Context
+
+	url            *url.URL
+	appID          string
+	hostname       string
+	converter      MessageConverter
+	circuitBreaker *CircuitBreaker
+	failing        atomic.Bool
+
+	egressMetric    metrics.Counter
+	droppedMetric   metrics.Counter
+	partitionMetric func(partition int32) metrics.Counter
+
+	mu               sync.Mutex
+	partitionMetrics map[int32]metrics.Counter
+}
+
+type KafkaOption func(*kafkaConfig)
+
+type kafkaConfig struct {
+	retryDuration RetryDuration
+	maxRetries    int
+}
+
+// WithKafkaRetries sets how often and after which backoff failed batches
+// are retried before their messages are dropped.
+func WithKafkaRetries(retryDuration RetryDuration, maxRetries int) KafkaOption {
+	return func(c *kafkaConfig) {
+		c.retryDuration = retryDuration
+		c.maxRetries = maxRetries
+	}
+}
+
+// NewKafkaWriter returns a KafkaWriter for a binding with a URL of the form
+// kafka://broker1;broker2/topic. Brokers are separated by semicolons since
+// aggregate drains are configured as comma separated lists, and use port
+// 9092 if they have none. The connections use TLS if tlsConf is set and
+// authenticate with SASL PLAIN if the binding credentials contain a
+// username. The partitionMetric returns the counter of messages delivered to
+// a partition.
+func NewKafkaWriter(
+	binding *URLBinding,
+	netConf NetworkTimeoutConfig,
+	tlsConf *tls.Config,
+	egressMetric metrics.Counter,
+	droppedMetric metrics.Counter,
+	partitionMetric func(partition int32) metrics.Counter,
+	c MessageConverter,
+	options ...KafkaOption,
+) (*KafkaWriter, error) {
+	topic := strings.Trim(binding.URL.Path, "/")
+	if topic == "" || strings.Contains(topic, "/") {
+		return nil, errors.New("kafka drain URL must contain a single topic as path")
+	}
+
+	var brokers []string
+	for _, b := range strings.Split(binding.URL.Host, ";") {
+		if b == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(b); err != nil {
+			b = net.JoinHostPort(b, defaultKafkaPort)
+		}
+		brokers = append(brokers, b)
+	}
+	if len(brokers) == 0 {
+		return nil, errors.New("kafka drain URL must contain at least one broker")
+	}
+
+	cfg := kafkaConfig{
+		retryDuration: ExponentialDuration,
+		maxRetries:    maxRetries,
+	}
+	for _, o := range options {
+		o(&cfg)
+	}
+
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(brokers...),
+		kgo.DefaultProduceTopic(topic),
+		kgo.RecordPartitioner(kgo.StickyKeyPartitioner(nil)),
+		kgo.RecordRetries(cfg.maxRetries),
+		kgo.RetryBackoffFn(cfg.retryDuration),
+	}
+	if netConf.DialTimeout > 0 {
+		opts = append(opts, kgo.DialTimeout(netConf.DialTimeout))
+	}
+	if netConf.WriteTimeout > 0 {
+		opts = append(opts, kgo.ProduceRequestTimeout(netConf.WriteTimeout))
+	}
+	if tlsConf != nil {
+		opts = append(opts, kgo.DialTLSConfig(tlsConf))
+	}
+	if binding.Username != "" {
+		opts = append(opts, kgo.SASL(plain.Auth{
+			User: binding.Username,
+			Pass: binding.Password,
+		}.AsMechanism()))
+	}
+
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := binding.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return &KafkaWriter{
+		client:           client,
+		ctx:              ctx,
+		url:              binding.URL,
+		appID:            binding.AppID,
+		hostname:         binding.Hostname,
+		converter:        c,
+		circuitBreaker:   binding.CircuitBreaker,
+		egressMetric:     egressMetric,
+		droppedMetric:    droppedMetric,
+		partitionMetric:  partitionMetric,
+		partitionMetrics: make(map[int32]metrics.Counter),
+	}, nil
+}
+
+// Write hands the messages of the envelope to the producer. It blocks while
+// the buffer of the producer is full.
+func (w *KafkaWriter) Write(env *loggregator_v2.Envelope) error {
+	msgs, err := w.converter.Convert(env, w.hostname)
+	if err != nil {
+		log.Printf("Failed to parse syslog, dropping message, err: %s", err)
+		return nil
+	}
+
+	for _, msg := range msgs {
+		if !w.circuitBreaker.Allow(1) {
+			continue
+		}
+		w.client.Produce(w.ctx, &kgo.Record{
+			Key:       []byte(env.GetSourceId()),
+			Value:     msg,
+			Timestamp: time.Unix(0, env.GetTimestamp()),
+		}, w.delivered)
+	}
+
+	return nil
+}
+
+// delivered is called by the producer once a message is acknowledged or
+// failed after all retries.
+func (w *KafkaWriter) delivered(r *kgo.Record, err error) {
+	if err != nil {
+		w.circuitBreaker.Failure()
+		w.droppedMetric.Add(1)
+		if !w.failing.Swap(true) {
+			log.Printf("Failed to deliver messages to %s after all retries, dropping them, err: %s", redactedURL(w.url), err)
+		}
+		return
+	}
+
+	w.circuitBreaker.Success()
+	w.failing.Store(false)
+	w.egressMetric.Add(1)
+	w.metricForPartition(r.Partition).Add(1)
+}
+
+func (w *KafkaWriter) metricForPartition(p int32) metrics.Counter {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	m, ok := w.partitionMetrics[p]
+	if !ok {
+		m = w.partitionMetric(p)
+		w.partitionMetrics[p] = m
+	}
+	return m
+}
+
+// Close waits until all buffered messages are delivered or failed and
+// closes the connections to the brokers.
+func (w *KafkaWriter) Close() error {
+	err := w.client.Flush(context.Background())
+	w.client.Close()
+	return err
+}
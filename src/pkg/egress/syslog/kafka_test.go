@@ -0,0 +1,204 @@
+package syslog_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("KafkaWriter", func() {
+	var (
+		cluster          *kfake.Cluster
+		binding          *syslog.URLBinding
+		egressCounter    *metricsHelpers.SpyMetric
+		droppedCounter   *metricsHelpers.SpyMetric
+		partitionMetrics map[int32]*metricsHelpers.SpyMetric
+	)
+
+	startCluster := func(opts ...kfake.Opt) {
+		var err error
+		cluster, err = kfake.NewCluster(append([]kfake.Opt{kfake.SeedTopics(4, "logs")}, opts...)...)
+		Expect(err).ToNot(HaveOccurred())
+
+		u, err := url.Parse("kafka://" + strings.Join(cluster.ListenAddrs(), ";") + "/logs")
+		Expect(err).ToNot(HaveOccurred())
+		binding = &syslog.URLBinding{Hostname: "test-hostname", URL: u, Context: context.Background()}
+	}
+
+	BeforeEach(func() {
+		egressCounter = &metricsHelpers.SpyMetric{}
+		droppedCounter = &metricsHelpers.SpyMetric{}
+		partitionMetrics = make(map[int32]*metricsHelpers.SpyMetric)
+	})
+
+	AfterEach(func() {
+		cluster.Close()
+	})
+
+	newWriter := func() *syslog.KafkaWriter {
+		writer, err := syslog.NewKafkaWriter(
+			binding,
+			syslog.NetworkTimeoutConfig{DialTimeout: time.Second, WriteTimeout: time.Second},
+			nil,
+			egressCounter,
+			droppedCounter,
+			func(p int32) metrics.Counter {
+				partitionMetrics[p] = &metricsHelpers.SpyMetric{}
+				return partitionMetrics[p]
+			},
+			syslog.NewConverter(),
+			syslog.WithKafkaRetries(func(int) time.Duration { return time.Millisecond }, 3),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		return writer
+	}
+
+	writeLogs := func(writer *syslog.KafkaWriter, sourceIDs ...string) {
+		for i, id := range sourceIDs {
+			env := buildLogEnvelope("APP", "1", "message "+strconv.Itoa(i), loggregator_v2.Log_OUT)
+			env.SourceId = id
+			Expect(writer.Write(env)).To(Succeed())
+		}
+	}
+
+	consume := func(n int, opts ...kgo.Opt) []*kgo.Record {
+		client, err := kgo.NewClient(append([]kgo.Opt{
+			kgo.SeedBrokers(cluster.ListenAddrs()...),
+			kgo.ConsumeTopics("logs"),
+			kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+		}, opts...)...)
+		Expect(err).ToNot(HaveOccurred())
+		defer client.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		var records []*kgo.Record
+		for len(records) < n {
+			fetches := client.PollFetches(ctx)
+			Expect(fetches.Err0()).ToNot(HaveOccurred())
+			records = append(records, fetches.Records()...)
+		}
+		return records
+	}
+
+	It("partitions messages by source id", func() {
+		startCluster()
+		writer := newWriter()
+
+		writeLogs(writer, "app-1", "app-3", "app-1")
+		Expect(writer.Close()).To(Succeed())
+
+		byKey := make(map[string][]*kgo.Record)
+		for _, r := range consume(3) {
+			byKey[string(r.Key)] = append(byKey[string(r.Key)], r)
+		}
+		Expect(byKey["app-1"]).To(HaveLen(2))
+		Expect(byKey["app-3"]).To(HaveLen(1))
+		Expect(byKey["app-1"][0].Partition).To(Equal(byKey["app-1"][1].Partition))
+		Expect(string(byKey["app-1"][0].Value)).To(ContainSubstring("message 0"))
+		Expect(string(byKey["app-1"][1].Value)).To(ContainSubstring("message 2"))
+
+		Expect(egressCounter.Value()).To(BeNumerically("==", 3))
+		p1, p3 := byKey["app-1"][0].Partition, byKey["app-3"][0].Partition
+		if p1 == p3 {
+			Expect(partitionMetrics[p1].Value()).To(BeNumerically("==", 3))
+		} else {
+			Expect(partitionMetrics[p1].Value()).To(BeNumerically("==", 2))
+			Expect(partitionMetrics[p3].Value()).To(BeNumerically("==", 1))
+		}
+	})
+
+	It("retries batches without duplicating them", func() {
+		startCluster()
+		var produces atomic.Int32
+		cluster.ControlKey(int16(kmsg.Produce), func(kmsg.Request) (kmsg.Response, error, bool) {
+			cluster.KeepControl()
+			if produces.Add(1) == 1 {
+				return nil, errors.New("connection dropped"), true
+			}
+			return nil, nil, false
+		})
+		writer := newWriter()
+
+		writeLogs(writer, "app-1", "app-1")
+		Expect(writer.Close()).To(Succeed())
+
+		Expect(produces.Load()).To(BeNumerically(">=", 2))
+		Expect(consume(2)).To(HaveLen(2))
+		Expect(egressCounter.Value()).To(BeNumerically("==", 2))
+		Expect(droppedCounter.Value()).To(BeZero())
+	})
+
+	It("drops messages the brokers do not accept", func() {
+		startCluster()
+		cluster.ControlKey(int16(kmsg.Produce), func(kreq kmsg.Request) (kmsg.Response, error, bool) {
+			cluster.KeepControl()
+			req := kreq.(*kmsg.ProduceRequest)
+			resp := req.ResponseKind().(*kmsg.ProduceResponse)
+			for _, t := range req.Topics {
+				rt := kmsg.NewProduceResponseTopic()
+				rt.Topic, rt.TopicID = t.Topic, t.TopicID
+				for _, p := range t.Partitions {
+					rp := kmsg.NewProduceResponseTopicPartition()
+					rp.Partition = p.Partition
+					rp.ErrorCode = kerr.MessageTooLarge.Code
+					rt.Partitions = append(rt.Partitions, rp)
+				}
+				resp.Topics = append(resp.Topics, rt)
+			}
+			return resp, nil, true
+		})
+		writer := newWriter()
+
+		writeLogs(writer, "app-1")
+		Expect(writer.Close()).To(Succeed())
+
+		Expect(egressCounter.Value()).To(BeZero())
+		Expect(droppedCounter.Value()).To(BeNumerically("==", 1))
+	})
+
+	It("authenticates with the binding credentials", func() {
+		startCluster(kfake.EnableSASL(), kfake.Superuser("PLAIN", "user", "secret"))
+		binding.Username = "user"
+		binding.Password = "secret"
+		writer := newWriter()
+
+		writeLogs(writer, "app-1")
+		Expect(writer.Close()).To(Succeed())
+
+		Expect(consume(1, kgo.SASL(plain.Auth{User: "user", Pass: "secret"}.AsMechanism()))).To(HaveLen(1))
+		Expect(egressCounter.Value()).To(BeNumerically("==", 1))
+	})
+
+	It("drops messages while the circuit breaker is open", func() {
+		startCluster()
+		dropped := &metricsHelpers.SpyMetric{}
+		binding.CircuitBreaker = syslog.NewCircuitBreaker(1, time.Hour, dropped, nil)
+		binding.CircuitBreaker.Failure()
+		writer := newWriter()
+
+		writeLogs(writer, "app-1")
+		Expect(writer.Close()).To(Succeed())
+
+		Expect(dropped.Value()).To(BeNumerically("==", 1))
+		Expect(egressCounter.Value()).To(BeZero())
+	})
+})
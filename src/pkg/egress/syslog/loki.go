@@ -0,0 +1,174 @@
+package syslog
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+)
+
+const lokiPushPath = "/loki/api/v1/push"
+
+// DefaultLokiLabels are the envelope tags used as stream labels unless the
+// drain URL selects others with the labels parameter.
+var DefaultLokiLabels = []string{"app_name", "space_name", "organization_name", "source_type"}
+
+// LokiConverter serializes every envelope as a Loki stream with a single
+// entry. The tags selected as labels form the stream labels, all other tags
+// are kept as structured metadata of the entry. Logs use their payload as
+// line, all other envelopes a JSON object describing the metric.
+type LokiConverter struct {
+	*Converter
+	labels []string
+}
+
+func NewLokiConverter(labels []string, opts ...ConverterOption) *LokiConverter {
+	return &LokiConverter{
+		Converter: NewConverter(opts...),
+		labels:    labels,
+	}
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values []json.RawMessage `json:"values"`
+}
+
+func (c *LokiConverter) Convert(env *loggregator_v2.Envelope, _ string) ([][]byte, error) {
+	return singleMessage(c.ToLoki(env))
+}
+
+// ToLoki returns the envelope as a newline terminated Loki stream.
+func (c *LokiConverter) ToLoki(env *loggregator_v2.Envelope) ([]byte, error) {
+	metadata := map[string]string{
+		"source_id":   env.GetSourceId(),
+		"instance_id": env.GetInstanceId(),
+	}
+
+	var line string
+	if l, ok := env.GetMessage().(*loggregator_v2.Envelope_Log); ok {
+		line = string(l.Log.GetPayload())
+		metadata["log_type"] = l.Log.GetType().String()
+	} else {
+		m := newJSONMetric(env)
+		if m == nil {
+			return nil, nil
+		}
+		b, err := json.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		line = string(b)
+	}
+
+	labels := make(map[string]string, len(c.labels))
+	tags := env.GetTags()
+	for _, name := range c.labels {
+		if v, ok := tags[name]; ok && v != "" {
+			labels[name] = v
+		}
+	}
+	if len(labels) == 0 {
+		// Loki rejects streams without labels.
+		labels["source_id"] = env.GetSourceId()
+	}
+
+	if !c.omitTags {
+		for k, v := range tags {
+			if _, ok := labels[k]; !ok {
+				metadata[k] = v
+			}
+		}
+	}
+
+	value, err := json.Marshal([]any{strconv.FormatInt(env.GetTimestamp(), 10), line, metadata})
+	if err != nil {
+		return nil, err
+	}
+	msg, err := json.Marshal(lokiStream{Stream: labels, Values: []json.RawMessage{value}})
+	if err != nil {
+		return nil, err
+	}
+	return append(msg, '\n'), nil
+}
+
+// encodeLokiBatch merges the streams of a batch of converted envelopes with
+// equal labels into a single push request. Streams keep the order of their
+// first entry and entries keep their order within a stream. The labels of a
+// converted envelope are serialized with sorted keys, so they are compared
+// as they are instead of being serialized again.
+func encodeLokiBatch(batch []byte) ([]byte, error) {
+	type rawStream struct {
+		Stream json.RawMessage   `json:"stream"`
+		Values []json.RawMessage `json:"values"`
+	}
+	var req struct {
+		Streams []*rawStream `json:"streams"`
+	}
+	streams := make(map[string]*rawStream)
+
+	for _, line := range bytes.Split(batch, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+
+		var s rawStream
+		if err := json.Unmarshal(line, &s); err != nil {
+			return nil, err
+		}
+
+		if existing, ok := streams[string(s.Stream)]; ok {
+			existing.Values = append(existing.Values, s.Values...)
+			continue
+		}
+		streams[string(s.Stream)] = &s
+		req.Streams = append(req.Streams, &s)
+	}
+
+	return json.Marshal(req)
+}
+
+// NewLokiWriter returns an HTTPSBatchWriter that sends batches of envelopes
+// to the push API of Grafana Loki as JSON. The envelopes are sent to
+// /loki/api/v1/push unless the URL has a path. The labels URL parameter
+// holds a comma separated list of envelope tags to use as stream labels
+// instead of DefaultLokiLabels.
+func NewLokiWriter(
+	binding *URLBinding,
+	netConf NetworkTimeoutConfig,
+	tlsConf *tls.Config,
+	egressMetric metrics.Counter,
+	opts []ConverterOption,
+	options ...Option,
+) egress.WriteCloser {
+	lokiBinding := *binding
+	u := *binding.URL
+	lokiBinding.URL = &u
+
+	if u.Path == "" || u.Path == "/" {
+		u.Path = lokiPushPath
+	}
+
+	labels := DefaultLokiLabels
+	q := u.Query()
+	if l := q.Get("labels"); l != "" {
+		labels = nil
+		for _, name := range strings.Split(l, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				labels = append(labels, name)
+			}
+		}
+		q.Del("labels")
+		u.RawQuery = q.Encode()
+	}
+
+	c := NewLokiConverter(labels, opts...)
+	options = append(options, withContentType(jsonContentType), withBatchEncoder(encodeLokiBatch))
+
+	return NewHTTPSBatchWriter(&lokiBinding, netConf, tlsConf, egressMetric, c, options...)
+}
@@ -0,0 +1,153 @@
+package syslog_test
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Loki", func() {
+	Describe("LokiConverter", func() {
+		It("converts a log envelope to a stream with a single entry", func() {
+			c := syslog.NewLokiConverter(syslog.DefaultLokiLabels)
+			env := buildLogEnvelope("APP", "2", "just a \"test\"", loggregator_v2.Log_ERR)
+			env.Tags["app_name"] = "some-app"
+			env.Tags["deployment"] = "cf"
+
+			msg, err := c.ToLoki(env)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(msg).To(HaveSuffix("\n"))
+			Expect(msg).To(MatchJSON(`{
+				"stream": {"app_name": "some-app", "source_type": "APP"},
+				"values": [["12345678", "just a \"test\"", {
+					"source_id": "test-app-id",
+					"instance_id": "2",
+					"log_type": "ERR",
+					"deployment": "cf"
+				}]]
+			}`))
+		})
+
+		It("labels the stream with the source id if none of the labels is set", func() {
+			c := syslog.NewLokiConverter([]string{"app_name", "source_type"})
+			env := buildLogEnvelope("", "2", "msg", loggregator_v2.Log_OUT)
+			env.Tags["deployment"] = "cf"
+
+			Expect(c.ToLoki(env)).To(MatchJSON(`{
+				"stream": {"source_id": "test-app-id"},
+				"values": [["12345678", "msg", {
+					"source_id": "test-app-id",
+					"instance_id": "2",
+					"log_type": "OUT",
+					"source_type": "",
+					"deployment": "cf"
+				}]]
+			}`))
+		})
+
+		It("converts metrics to a JSON line", func() {
+			c := syslog.NewLokiConverter(syslog.DefaultLokiLabels)
+
+			msg, err := c.ToLoki(buildCounterEnvelope("1"))
+			Expect(err).ToNot(HaveOccurred())
+			var stream struct{ Values [][]any }
+			Expect(json.Unmarshal(msg, &stream)).To(Succeed())
+			Expect(stream.Values[0][1]).To(MatchJSON(`{"counter": {"name": "some-counter", "total": 99, "delta": 1}}`))
+		})
+
+		It("omits the remaining tags if configured", func() {
+			c := syslog.NewLokiConverter([]string{"deployment"}, syslog.WithoutSyslogMetadata())
+			env := buildLogEnvelope("APP", "2", "msg", loggregator_v2.Log_OUT)
+			env.Tags["deployment"] = "cf"
+
+			Expect(c.ToLoki(env)).To(MatchJSON(`{
+				"stream": {"deployment": "cf"},
+				"values": [["12345678", "msg", {"source_id": "test-app-id", "instance_id": "2", "log_type": "OUT"}]]
+			}`))
+		})
+	})
+
+	Describe("NewLokiWriter", func() {
+		var drain *rawDrain
+
+		BeforeEach(func() {
+			drain = newRawMockDrain(http.StatusNoContent)
+			DeferCleanup(drain.Close)
+		})
+
+		It("groups a batch of envelopes into streams", func() {
+			b := buildURLBinding(drain.URL+"?labels=source_type", "test-app-id", "test-hostname")
+			b.URL.Scheme = "loki"
+
+			writer := syslog.NewLokiWriter(
+				b,
+				syslog.NetworkTimeoutConfig{},
+				&tls.Config{InsecureSkipVerify: true}, //nolint:gosec
+				&metricsHelpers.SpyMetric{},
+				[]syslog.ConverterOption{syslog.WithoutSyslogMetadata()},
+				syslog.WithSendInterval(50*time.Millisecond),
+			)
+			defer writer.Close()
+
+			Expect(writer.Write(buildLogEnvelope("APP", "1", "message 1", loggregator_v2.Log_OUT))).To(Succeed())
+			Expect(writer.Write(buildLogEnvelope("RTR", "1", "message 2", loggregator_v2.Log_OUT))).To(Succeed())
+			Expect(writer.Write(buildLogEnvelope("APP", "2", "message 3", loggregator_v2.Log_OUT))).To(Succeed())
+
+			Eventually(drain.getBodies).Should(HaveLen(1))
+			r := drain.getRequests()[0]
+			Expect(r.URL.Path).To(Equal("/loki/api/v1/push"))
+			Expect(r.URL.RawQuery).To(BeEmpty())
+			Expect(r.Header.Get("Content-Type")).To(Equal("application/json"))
+			Expect(drain.getBodies()[0]).To(MatchJSON(`{"streams": [
+				{
+					"stream": {"source_type": "APP"},
+					"values": [
+						["12345678", "message 1", {"source_id": "test-app-id", "instance_id": "1", "log_type": "OUT"}],
+						["12345678", "message 3", {"source_id": "test-app-id", "instance_id": "2", "log_type": "OUT"}]
+					]
+				},
+				{
+					"stream": {"source_type": "RTR"},
+					"values": [
+						["12345678", "message 2", {"source_id": "test-app-id", "instance_id": "1", "log_type": "OUT"}]
+					]
+				}
+			]}`))
+		})
+
+		It("sends the same streams again when a push is retried", func() {
+			drain.failNext(1)
+			b := buildURLBinding(drain.URL, "test-app-id", "test-hostname")
+			b.URL.Scheme = "loki"
+			b.Context = context.Background()
+
+			writer := syslog.NewLokiWriter(
+				b,
+				syslog.NetworkTimeoutConfig{},
+				&tls.Config{InsecureSkipVerify: true}, //nolint:gosec
+				&metricsHelpers.SpyMetric{},
+				nil,
+				syslog.WithSendInterval(50*time.Millisecond),
+			)
+			writer.(syslog.InternalRetryWriter).ConfigureRetry(func(int) time.Duration {
+				return time.Millisecond
+			}, 2)
+			defer writer.Close()
+
+			Expect(writer.Write(buildLogEnvelope("APP", "1", "message 1", loggregator_v2.Log_OUT))).To(Succeed())
+			Expect(writer.Write(buildLogEnvelope("RTR", "1", "message 2", loggregator_v2.Log_OUT))).To(Succeed())
+
+			Eventually(drain.getBodies).Should(HaveLen(1))
+			Expect(drain.getBodies()[0]).To(Equal(drain.getRejected()[0]))
+			Expect(drain.getBodies()[0]).To(ContainSubstring(`"streams":[{`))
+		})
+	})
+})
@@ -0,0 +1,76 @@
+package syslog
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"net/http"
+
+	metrics "code.cloudfoundry.org/go-metric-registry"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/otelcolclient"
+)
+
+// OTLPWriter exports envelopes to an OTLP/HTTP receiver. Unlike the client
+// it embeds it writes all pending batches when it is closed.
+type OTLPWriter struct {
+	*otelcolclient.Client
+}
+
+// Close writes all pending batches and closes the writer.
+func (w OTLPWriter) Close() error {
+	return w.FlushAndClose()
+}
+
+// NewOTLPWriter returns a writer that translates envelopes to OpenTelemetry
+// signals and exports them in batches as protobuf over HTTP. Logs and events
+// are exported as logs, counters and gauges as metrics and timers as traces,
+// as far as the drain data of the binding selects them. Failed exports are
+// retried up to maxRetries times until the context of the binding is done or
+// the circuit breaker of the binding opens.
+func NewOTLPWriter(
+	binding *URLBinding,
+	tlsConf *tls.Config,
+	egressMetric metrics.Counter,
+	maxRetries int,
+) OTLPWriter {
+	// The query holds the drain parameters, which are not meant for the
+	// receiver.
+	u := *binding.URL
+	u.Scheme = "https"
+	u.RawQuery = ""
+
+	headers := make(http.Header, len(binding.Headers))
+	for _, h := range binding.Headers {
+		headers.Set(h.Name, h.Value)
+	}
+
+	ctx := binding.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	cfg := otelcolclient.HTTPWriterConfig{
+		MaxRetries:   maxRetries,
+		Headers:      headers,
+		EgressMetric: egressMetric,
+	}
+	if binding.CircuitBreaker != nil {
+		cfg.CircuitBreaker = binding.CircuitBreaker
+	}
+
+	w := otelcolclient.NewHTTPWriter(
+		ctx,
+		&u,
+		tlsConf,
+		cfg,
+		log.Default(),
+	)
+
+	dd := binding.DrainData
+	return OTLPWriter{otelcolclient.New(
+		w,
+		dd == TRACES || dd == ALL,
+		sendsMetrics(dd) || dd == ALL,
+		sendsLogs(dd) || dd == ALL,
+	)}
+}
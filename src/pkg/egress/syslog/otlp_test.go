@@ -0,0 +1,80 @@
+package syslog_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OTLPWriter", func() {
+	var (
+		mu       sync.Mutex
+		requests []*http.Request
+		server   *httptest.Server
+		binding  *syslog.URLBinding
+		cancel   context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		requests = nil
+		server = httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			requests = append(requests, r)
+		}))
+		DeferCleanup(server.Close)
+
+		u, err := url.Parse(strings.Replace(server.URL, "https", "otlp-https", 1) + "/otlp?drain-data=all&header-x-tenant=some-tenant")
+		Expect(err).ToNot(HaveOccurred())
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		binding = &syslog.URLBinding{
+			Context:   ctx,
+			URL:       u,
+			DrainData: syslog.ALL,
+			Headers:   []syslog.Header{{Name: "X-Tenant", Value: "some-tenant"}},
+		}
+	})
+
+	sentRequests := func() []*http.Request {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]*http.Request(nil), requests...)
+	}
+
+	It("exports to the endpoints without the drain parameters", func() {
+		w := syslog.NewOTLPWriter(binding, server.Client().Transport.(*http.Transport).TLSClientConfig, &metricsHelpers.SpyMetric{}, 0)
+		DeferCleanup(w.Close)
+
+		Expect(w.Write(buildLogEnvelope("APP", "1", "a log", loggregator_v2.Log_OUT))).To(Succeed())
+
+		Eventually(sentRequests).Should(HaveLen(1))
+		r := sentRequests()[0]
+		Expect(r.URL.Path).To(Equal("/otlp/v1/logs"))
+		Expect(r.URL.RawQuery).To(BeEmpty())
+		Expect(r.Header.Get("X-Tenant")).To(Equal("some-tenant"))
+	})
+
+	It("writes the pending batches when it is closed after the binding is done", func() {
+		egressMetric := &metricsHelpers.SpyMetric{}
+		w := syslog.NewOTLPWriter(binding, server.Client().Transport.(*http.Transport).TLSClientConfig, egressMetric, 0)
+		Expect(w.Write(buildLogEnvelope("APP", "1", "a log", loggregator_v2.Log_OUT))).To(Succeed())
+
+		cancel()
+		Expect(w.Close()).To(Succeed())
+
+		Expect(sentRequests()).To(HaveLen(1))
+		Expect(egressMetric.Value()).To(BeNumerically("==", 1))
+	})
+})
@@ -0,0 +1,153 @@
+package syslog
+
+import (
+	"bytes"
+	"strconv"
+	"unicode/utf8"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rfc5424"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+)
+
+// OversizedMessages selects how log messages that exceed the maximum
+// message size of a drain are handled.
+type OversizedMessages int
+
+const (
+	// SplitOversized splits the payload into several messages that carry
+	// their position in a frag@47450 structured data element.
+	SplitOversized OversizedMessages = iota
+	// TruncateOversized cuts the payload and marks the message with a
+	// truncated@47450 structured data element.
+	TruncateOversized
+)
+
+// MinMessageSize is the smallest maximum message size a drain can set.
+// RFC 5424 requires receivers to accept messages of this size.
+const MinMessageSize = 480
+
+const (
+	fragmentStructuredDataID  = "frag@47450"
+	truncatedStructuredDataID = "truncated@47450"
+)
+
+// WithMaxMessageSize limits the size of RFC 5424 log messages. Oversized
+// messages are split or truncated and counted by the respective metric.
+func WithMaxMessageSize(size int, o OversizedMessages, splitMetric, truncatedMetric metrics.Counter) ConverterOption {
+	return func(c *Converter) {
+		c.maxMessageSize = max(size, MinMessageSize)
+		c.oversizedMessages = o
+		c.splitMetric = splitMetric
+		c.truncatedMetric = truncatedMetric
+	}
+}
+
+// fitLogMessage marshals the message and splits or truncates it if it
+// exceeds the maximum message size.
+func (c *Converter) fitLogMessage(m rfc5424.Message) ([][]byte, error) {
+	messageBinary, err := m.MarshalBinary()
+	if err != nil || c.maxMessageSize == 0 || len(messageBinary) <= c.maxMessageSize {
+		return [][]byte{messageBinary}, err
+	}
+
+	payload := bytes.TrimSuffix(m.Message, []byte("\n"))
+	if c.oversizedMessages == SplitOversized {
+		// Neither the sequence number nor the number of fragments can have
+		// more digits than the size of the payload.
+		placeholder := strconv.Itoa(len(payload))
+		room, err := c.payloadRoom(m, fragmentStructuredData(placeholder, placeholder))
+		if err != nil {
+			return nil, err
+		}
+		if room > 0 {
+			return c.splitLogMessage(m, payload, room)
+		}
+	}
+
+	return c.truncateLogMessage(m, payload)
+}
+
+func (c *Converter) splitLogMessage(m rfc5424.Message, payload []byte, room int) ([][]byte, error) {
+	fragments := splitUTF8(payload, room)
+	sd := append(m.StructuredData[:len(m.StructuredData):len(m.StructuredData)], rfc5424.StructuredData{})
+
+	messages := make([][]byte, 0, len(fragments))
+	for i, f := range fragments {
+		sd[len(sd)-1] = fragmentStructuredData(strconv.Itoa(i+1), strconv.Itoa(len(fragments)))
+		m.StructuredData = sd
+		m.Message = appendNewline(bytes.Clone(f))
+
+		messageBinary, err := m.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, messageBinary)
+	}
+
+	c.splitMetric.Add(1)
+	return messages, nil
+}
+
+func (c *Converter) truncateLogMessage(m rfc5424.Message, payload []byte) ([][]byte, error) {
+	sd := rfc5424.StructuredData{
+		ID:         truncatedStructuredDataID,
+		Parameters: []rfc5424.SDParam{{Name: "size", Value: strconv.Itoa(len(payload))}},
+	}
+	room, err := c.payloadRoom(m, sd)
+	if err != nil {
+		return nil, err
+	}
+
+	m.StructuredData = append(m.StructuredData[:len(m.StructuredData):len(m.StructuredData)], sd)
+	m.Message = appendNewline(bytes.Clone(splitUTF8(payload, max(room, 0))[0]))
+	messageBinary, err := m.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	c.truncatedMetric.Add(1)
+	return [][]byte{messageBinary}, nil
+}
+
+// payloadRoom returns the number of payload bytes that fit into a message
+// with the additional structured data element.
+func (c *Converter) payloadRoom(m rfc5424.Message, sd rfc5424.StructuredData) (int, error) {
+	m.StructuredData = append(m.StructuredData[:len(m.StructuredData):len(m.StructuredData)], sd)
+	m.Message = []byte("\n")
+	header, err := m.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+	return c.maxMessageSize - len(header), nil
+}
+
+// splitUTF8 splits b into chunks of at most n bytes without splitting
+// multi-byte characters. It always returns at least one chunk.
+func splitUTF8(b []byte, n int) [][]byte {
+	var chunks [][]byte
+	for len(b) > n {
+		cut := n
+		for cut > 0 && !utf8.RuneStart(b[cut]) {
+			cut--
+		}
+		if cut == 0 {
+			if n == 0 {
+				return [][]byte{nil}
+			}
+			cut = n
+		}
+		chunks = append(chunks, b[:cut])
+		b = b[cut:]
+	}
+	return append(chunks, b)
+}
+
+func fragmentStructuredData(seq, total string) rfc5424.StructuredData {
+	return rfc5424.StructuredData{
+		ID: fragmentStructuredDataID,
+		Parameters: []rfc5424.SDParam{
+			{Name: "seq", Value: seq},
+			{Name: "total", Value: total},
+		},
+	}
+}
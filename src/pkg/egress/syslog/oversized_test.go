@@ -0,0 +1,109 @@
+package syslog_test
+
+import (
+	"regexp"
+	"strings"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Oversized messages", func() {
+	var (
+		splitMetric     *metricsHelpers.SpyMetric
+		truncatedMetric *metricsHelpers.SpyMetric
+	)
+
+	BeforeEach(func() {
+		splitMetric = &metricsHelpers.SpyMetric{}
+		truncatedMetric = &metricsHelpers.SpyMetric{}
+	})
+
+	newConverter := func(size int, o syslog.OversizedMessages) *syslog.Converter {
+		return syslog.NewConverter(syslog.WithMaxMessageSize(size, o, splitMetric, truncatedMetric))
+	}
+
+	// payloadOf returns the payload of a message with structured data.
+	payloadOf := func(msg []byte) string {
+		i := strings.LastIndex(string(msg), "\"] ")
+		Expect(i).To(BeNumerically(">", 0))
+		return string(msg[i+3:])
+	}
+
+	It("does not change messages that fit", func() {
+		env := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
+
+		Expect(newConverter(1024, syslog.SplitOversized).ToRFC5424(env, "test-hostname")).To(Equal([][]byte{
+			[]byte("<14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [APP/2] - [tags@47450 source_type=\"APP\"] just a test\n"),
+		}))
+		Expect(splitMetric.Value()).To(BeNumerically("==", 0))
+		Expect(truncatedMetric.Value()).To(BeNumerically("==", 0))
+	})
+
+	It("splits oversized log messages into fragments", func() {
+		payload := strings.Repeat("a", 1000)
+		env := buildLogEnvelope("APP", "2", payload, loggregator_v2.Log_OUT)
+
+		msgs, err := newConverter(500, syslog.SplitOversized).ToRFC5424(env, "test-hostname")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(msgs).To(HaveLen(3))
+
+		var joined string
+		for i, msg := range msgs {
+			Expect(len(msg)).To(BeNumerically("<=", 500))
+			Expect(string(msg)).To(HavePrefix(
+				"<14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [APP/2] - [tags@47450 source_type=\"APP\"]" +
+					"[frag@47450 seq=\"" + string(rune('1'+i)) + "\" total=\"3\"] ",
+			))
+			Expect(string(msg)).To(HaveSuffix("\n"))
+			joined += strings.TrimSuffix(payloadOf(msg), "\n")
+		}
+		Expect(joined).To(Equal(payload))
+		Expect(splitMetric.Value()).To(BeNumerically("==", 1))
+	})
+
+	It("does not split multi-byte characters", func() {
+		payload := strings.Repeat("ä", 500)
+		env := buildLogEnvelope("APP", "2", payload, loggregator_v2.Log_OUT)
+
+		msgs, err := newConverter(500, syslog.SplitOversized).ToRFC5424(env, "test-hostname")
+		Expect(err).ToNot(HaveOccurred())
+
+		var joined string
+		for _, msg := range msgs {
+			p := strings.TrimSuffix(payloadOf(msg), "\n")
+			Expect(regexp.MustCompile("^(ä)+$").MatchString(p)).To(BeTrue())
+			joined += p
+		}
+		Expect(joined).To(Equal(payload))
+	})
+
+	It("truncates oversized log messages", func() {
+		payload := strings.Repeat("a", 1000)
+		env := buildLogEnvelope("APP", "2", payload, loggregator_v2.Log_OUT)
+
+		msgs, err := newConverter(500, syslog.TruncateOversized).ToRFC5424(env, "test-hostname")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(msgs).To(HaveLen(1))
+		Expect(msgs[0]).To(HaveLen(500))
+		Expect(string(msgs[0])).To(MatchRegexp(
+			`^<14>1 \S+ test-hostname test-app-id \[APP/2\] - \[tags@47450 source_type="APP"\]\[truncated@47450 size="1000"\] a+\n$`,
+		))
+		Expect(truncatedMetric.Value()).To(BeNumerically("==", 1))
+		Expect(splitMetric.Value()).To(BeNumerically("==", 0))
+	})
+
+	It("does not limit messages below the minimum message size", func() {
+		payload := strings.Repeat("a", 400)
+		env := buildLogEnvelope("APP", "2", payload, loggregator_v2.Log_OUT)
+
+		msgs, err := newConverter(100, syslog.TruncateOversized).ToRFC5424(env, "test-hostname")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(msgs).To(HaveLen(1))
+		Expect(len(msgs[0])).To(BeNumerically("<=", syslog.MinMessageSize))
+	})
+})
@@ -0,0 +1,94 @@
+package syslog
+
+import (
+	"hash/fnv"
+	"log"
+	"sync"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+)
+
+// MaxConnectionsPerDrain limits the number of connections a single drain can
+// request.
+const MaxConnectionsPerDrain = 16
+
+// ParallelWriter spreads envelopes across several writers that each write
+// from their own goroutine. All envelopes of an instance are written by the
+// same writer and therefore stay in order.
+type ParallelWriter struct {
+	conns []chan *loggregator_v2.Envelope
+	wg    sync.WaitGroup
+}
+
+// NewParallelWriter starts a goroutine for every writer. Each writer is only
+// used from its goroutine, including Close.
+func NewParallelWriter(writers []egress.WriteCloser) *ParallelWriter {
+	pw := &ParallelWriter{
+		conns: make([]chan *loggregator_v2.Envelope, len(writers)),
+	}
+
+	for i, w := range writers {
+		ch := make(chan *loggregator_v2.Envelope)
+		pw.conns[i] = ch
+
+		pw.wg.Add(1)
+		go pw.run(ch, w)
+	}
+
+	return pw
+}
+
+// Write hands the envelope to the writer of its instance. It blocks until the
+// writer is ready to accept it.
+func (p *ParallelWriter) Write(env *loggregator_v2.Envelope) error {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(env.GetSourceId()))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(env.GetInstanceId()))
+
+	p.conns[h.Sum32()%uint32(len(p.conns))] <- env //nolint:gosec
+
+	return nil
+}
+
+// Close stops all goroutines after they wrote the pending envelopes and
+// closes the writers.
+func (p *ParallelWriter) Close() error {
+	for _, ch := range p.conns {
+		close(ch)
+	}
+	p.wg.Wait()
+
+	return nil
+}
+
+func (p *ParallelWriter) run(ch <-chan *loggregator_v2.Envelope, w egress.WriteCloser) {
+	defer p.wg.Done()
+	defer func() {
+		if err := w.Close(); err != nil {
+			log.Printf("failed to close parallel syslog connection: %s", err)
+		}
+	}()
+
+	for env := range ch {
+		_ = w.Write(env)
+	}
+}
+
+// countingWriter counts the envelopes that its writer wrote successfully.
+// It wraps the connection below the RetryWriter, so that envelopes the
+// circuit breaker drops are not counted.
+type countingWriter struct {
+	egress.WriteCloser
+	egressMetric metrics.Counter
+}
+
+func (w *countingWriter) Write(env *loggregator_v2.Envelope) error {
+	if err := w.WriteCloser.Write(env); err != nil {
+		return err
+	}
+	w.egressMetric.Add(1)
+	return nil
+}
@@ -0,0 +1,90 @@
+package syslog_test
+
+import (
+	"fmt"
+	"sync"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParallelWriter", func() {
+	var (
+		writers []*recordingWriteCloser
+		pw      *syslog.ParallelWriter
+	)
+
+	BeforeEach(func() {
+		writers = nil
+		var wcs []egress.WriteCloser
+		for i := 0; i < 4; i++ {
+			w := &recordingWriteCloser{}
+			writers = append(writers, w)
+			wcs = append(wcs, w)
+		}
+		pw = syslog.NewParallelWriter(wcs)
+	})
+
+	It("spreads instances across writers and keeps their order", func() {
+		for i := 0; i < 100; i++ {
+			for instance := 0; instance < 8; instance++ {
+				Expect(pw.Write(&loggregator_v2.Envelope{
+					SourceId:   "app",
+					InstanceId: fmt.Sprint(instance),
+					Tags:       map[string]string{"seq": fmt.Sprint(i)},
+				})).To(Succeed())
+			}
+		}
+		Expect(pw.Close()).To(Succeed())
+
+		used := 0
+		var total int
+		for _, w := range writers {
+			Expect(w.closed).To(BeTrue())
+			total += len(w.envelopes())
+			if len(w.envelopes()) > 0 {
+				used++
+			}
+
+			next := map[string]int{}
+			for _, env := range w.envelopes() {
+				Expect(env.Tags["seq"]).To(Equal(fmt.Sprint(next[env.InstanceId])))
+				next[env.InstanceId]++
+			}
+			for _, n := range next {
+				Expect(n).To(Equal(100))
+			}
+		}
+		Expect(used).To(BeNumerically(">", 1))
+		Expect(total).To(Equal(800))
+	})
+})
+
+type recordingWriteCloser struct {
+	mu     sync.Mutex
+	envs   []*loggregator_v2.Envelope
+	closed bool
+}
+
+func (w *recordingWriteCloser) Write(env *loggregator_v2.Envelope) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.envs = append(w.envs, env)
+	return nil
+}
+
+func (w *recordingWriteCloser) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	return nil
+}
+
+func (w *recordingWriteCloser) envelopes() []*loggregator_v2.Envelope {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.envs
+}
@@ -0,0 +1,115 @@
+package syslog
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+)
+
+// tokenBucket allows rate events per second on average and bursts of up to
+// burst events.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst int) *tokenBucket {
+	if burst <= 0 {
+		burst = rate
+	}
+	return &tokenBucket{
+		rate:   float64(rate),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+func (b *tokenBucket) take(now time.Time) bool {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// RateLimitWriter drops envelopes that exceed the rate limit of a drain. The
+// number of dropped envelopes is reported periodically until the context is
+// done.
+type RateLimitWriter struct {
+	writer egress.Writer
+	onDrop func(dropped int)
+
+	mu        sync.Mutex
+	bucket    *tokenBucket
+	discarded int
+}
+
+// NewRateLimitWriter returns a writer that allows rate envelopes per second
+// and bursts of up to burst envelopes to be written. A burst of 0 equals the
+// rate. onDrop is called for every dropped envelope and report every interval
+// with the number of envelopes dropped since its last call, if any.
+func NewRateLimitWriter(
+	ctx context.Context,
+	w egress.Writer,
+	rate, burst int,
+	interval time.Duration,
+	onDrop func(dropped int),
+	report func(discarded int),
+) *RateLimitWriter {
+	rw := &RateLimitWriter{
+		writer: w,
+		onDrop: onDrop,
+		bucket: newTokenBucket(rate, burst),
+	}
+	go rw.reportDiscarded(ctx, interval, report)
+
+	return rw
+}
+
+func (w *RateLimitWriter) Write(env *loggregator_v2.Envelope) error {
+	w.mu.Lock()
+	allowed := w.bucket.take(time.Now())
+	if !allowed {
+		w.discarded++
+	}
+	w.mu.Unlock()
+
+	if !allowed {
+		w.onDrop(1)
+		return nil
+	}
+	return w.writer.Write(env)
+}
+
+func (w *RateLimitWriter) reportDiscarded(ctx context.Context, interval time.Duration, report func(int)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.mu.Lock()
+			discarded := w.discarded
+			w.discarded = 0
+			w.mu.Unlock()
+
+			if discarded > 0 {
+				report(discarded)
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package syslog_test
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RateLimitWriter", func() {
+	var (
+		ctx       context.Context
+		cancel    context.CancelFunc
+		spyWriter *spyWriteCloser
+		dropped   int
+		mu        sync.Mutex
+		reports   []int
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		spyWriter = &spyWriteCloser{}
+		dropped = 0
+		reports = nil
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	newWriter := func(rate, burst int, interval time.Duration) *syslog.RateLimitWriter {
+		return syslog.NewRateLimitWriter(ctx, spyWriter, rate, burst, interval,
+			func(n int) {
+				dropped += n
+			},
+			func(n int) {
+				mu.Lock()
+				defer mu.Unlock()
+				reports = append(reports, n)
+			},
+		)
+	}
+
+	getReports := func() []int {
+		mu.Lock()
+		defer mu.Unlock()
+		return reports
+	}
+
+	It("writes envelopes up to the burst and drops the rest", func() {
+		w := newWriter(1, 5, time.Hour)
+
+		for i := 0; i < 8; i++ {
+			Expect(w.Write(&loggregator_v2.Envelope{})).To(Succeed())
+		}
+
+		Expect(spyWriter.WriteAttempts()).To(Equal(5))
+		Expect(dropped).To(Equal(3))
+	})
+
+	It("uses the rate as burst if no burst is given", func() {
+		w := newWriter(3, 0, time.Hour)
+
+		for i := 0; i < 5; i++ {
+			Expect(w.Write(&loggregator_v2.Envelope{})).To(Succeed())
+		}
+
+		Expect(spyWriter.WriteAttempts()).To(Equal(3))
+	})
+
+	It("refills tokens over time", func() {
+		w := newWriter(100, 1, time.Hour)
+
+		Expect(w.Write(&loggregator_v2.Envelope{})).To(Succeed())
+		Expect(w.Write(&loggregator_v2.Envelope{})).To(Succeed())
+		Expect(spyWriter.WriteAttempts()).To(Equal(1))
+
+		time.Sleep(20 * time.Millisecond)
+		Expect(w.Write(&loggregator_v2.Envelope{})).To(Succeed())
+		Expect(spyWriter.WriteAttempts()).To(Equal(2))
+	})
+
+	It("periodically reports the number of dropped envelopes", func() {
+		w := newWriter(1, 1, 50*time.Millisecond)
+
+		for i := 0; i < 4; i++ {
+			Expect(w.Write(&loggregator_v2.Envelope{})).To(Succeed())
+		}
+
+		Eventually(getReports).Should(Equal([]int{3}))
+		Consistently(getReports, 150*time.Millisecond).Should(Equal([]int{3}))
+	})
+})
@@ -0,0 +1,176 @@
+package syslog
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultRedactionReplacement replaces matches of rules that do not
+// configure a replacement.
+const DefaultRedactionReplacement = "[REDACTED]"
+
+// AllRedactionRules selects every configured rule for a drain.
+const AllRedactionRules = "all"
+
+// RedactionRule replaces matches of a regular expression in log payloads.
+type RedactionRule struct {
+	Name string
+
+	pattern     *regexp.Regexp
+	replacement []byte
+	// validate filters matches that are likely false positives.
+	validate func([]byte) bool
+}
+
+// NewRedactionRule returns a rule that replaces all matches of the pattern.
+// The replacement may reference submatches, e.g. "password=$1***". An empty
+// replacement equals DefaultRedactionReplacement.
+func NewRedactionRule(name, pattern, replacement string) (RedactionRule, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return RedactionRule{}, fmt.Errorf("invalid pattern for redaction rule %s: %w", name, err)
+	}
+	if replacement == "" {
+		replacement = DefaultRedactionReplacement
+	}
+
+	return RedactionRule{
+		Name:        name,
+		pattern:     re,
+		replacement: []byte(replacement),
+	}, nil
+}
+
+// SelectRedactionRules returns the rules with the given comma separated
+// names, or all rules for AllRedactionRules. Unknown names are an error so
+// that drains do not receive payloads that were meant to be redacted.
+func SelectRedactionRules(rules []RedactionRule, names string) ([]RedactionRule, error) {
+	if names == AllRedactionRules {
+		return rules, nil
+	}
+
+	var selected []RedactionRule
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		i := slices.IndexFunc(rules, func(r RedactionRule) bool { return r.Name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown redaction rule %q", name)
+		}
+		selected = append(selected, rules[i])
+	}
+	return selected, nil
+}
+
+// BuiltinRedactionRules returns the rules that are available without
+// configuration: "jwt" for JSON web tokens, "aws-access-key" for AWS access
+// key IDs and "pan" for payment card numbers that pass the Luhn check.
+func BuiltinRedactionRules() []RedactionRule {
+	return []RedactionRule{
+		{
+			Name:        "jwt",
+			pattern:     regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`),
+			replacement: []byte(DefaultRedactionReplacement),
+		},
+		{
+			Name:        "aws-access-key",
+			pattern:     regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+			replacement: []byte(DefaultRedactionReplacement),
+		},
+		{
+			Name:        "pan",
+			pattern:     regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+			replacement: []byte(DefaultRedactionReplacement),
+			validate:    luhnValid,
+		},
+	}
+}
+
+// redact returns the payload with all matches replaced and the number of
+// replaced matches. The payload is not modified.
+func (r RedactionRule) redact(payload []byte) ([]byte, int) {
+	var out []byte
+	var n, last int
+	for _, m := range r.pattern.FindAllSubmatchIndex(payload, -1) {
+		if r.validate != nil && !r.validate(payload[m[0]:m[1]]) {
+			continue
+		}
+		out = append(out, payload[last:m[0]]...)
+		out = r.pattern.Expand(out, r.replacement, payload, m)
+		last = m[1]
+		n++
+	}
+	if n == 0 {
+		return payload, 0
+	}
+	return append(out, payload[last:]...), n
+}
+
+// luhnValid reports whether the digits in b pass the Luhn check. Other
+// characters are ignored.
+func luhnValid(b []byte) bool {
+	var sum, digits int
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < '0' || b[i] > '9' {
+			continue
+		}
+		d := int(b[i] - '0')
+		if digits%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+	}
+	return digits >= 13 && digits <= 19 && sum%10 == 0
+}
+
+// RedactingWriter applies redaction rules to the payloads of logs before
+// they are written. Envelopes are copied before they are changed since they
+// are shared with other drains.
+type RedactingWriter struct {
+	writer  egress.Writer
+	rules   []RedactionRule
+	metrics []metrics.Counter
+}
+
+// NewRedactingWriter returns a writer that applies the rules in order. The
+// number of redactions of each rule is added to the metric at the same index.
+func NewRedactingWriter(w egress.Writer, rules []RedactionRule, m []metrics.Counter) *RedactingWriter {
+	return &RedactingWriter{
+		writer:  w,
+		rules:   rules,
+		metrics: m,
+	}
+}
+
+func (w *RedactingWriter) Write(env *loggregator_v2.Envelope) error {
+	if env.GetLog() == nil {
+		return w.writer.Write(env)
+	}
+
+	payload := env.GetLog().GetPayload()
+	redacted := false
+	for i, r := range w.rules {
+		var n int
+		payload, n = r.redact(payload)
+		if n > 0 {
+			w.metrics[i].Add(float64(n))
+			redacted = true
+		}
+	}
+
+	if redacted {
+		env = proto.Clone(env).(*loggregator_v2.Envelope)
+		env.GetLog().Payload = payload
+	}
+	return w.writer.Write(env)
+}
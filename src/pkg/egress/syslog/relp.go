@@ -0,0 +1,479 @@
+package syslog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+	v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/ingress/v2"
+)
+
+const (
+	// relpWindowSize is the number of messages that may be sent without
+	// being acknowledged by the drain.
+	relpWindowSize = 128
+	relpMaxTxnr    = 999999999
+	// relpMaxResponseSize limits the data of frames received from a drain,
+	// which only sends responses.
+	relpMaxResponseSize = 64 * 1024
+	relpOffers          = "relp_version=0\nrelp_software=loggregator-agent\ncommands=syslog"
+)
+
+var (
+	errMalformedRELPFrame = errors.New("malformed RELP frame")
+	errRELPServerClose    = errors.New("RELP drain closed the session")
+	errRELPWindowTimeout  = errors.New("timed out waiting for RELP acknowledgements")
+)
+
+// RELPWriter represents a syslog writer that delivers messages with the
+// Reliable Event Logging Protocol over TCP or TLS. Messages only count as
+// egressed once the drain acknowledges them. Messages that are not
+// acknowledged when the connection drops are sent again after reconnecting,
+// so a drain may receive them twice. Messages that the drain rejects or that
+// are not acknowledged when the writer is closed are counted as dropped.
+// Like the TCPWriter, this writer is not meant to be used from multiple
+// goroutines.
+type RELPWriter struct {
+	url             *url.URL
+	appID           string
+	hostname        string
+	dialFunc        DialFunc
+	writeTimeout    time.Duration
+	window          int
+	syslogConverter MessageConverter
+
+	egressMetric  metrics.Counter
+	droppedMetric metrics.Counter
+
+	appLogClient v2.LogClient
+
+	session *relpSession
+	txnr    int
+
+	mu      sync.Mutex
+	pending []relpFrame
+	acked   chan struct{}
+}
+
+// relpFrame is a syslog message that has not been acknowledged yet.
+type relpFrame struct {
+	txnr int
+	msg  []byte
+}
+
+// relpSession is a connection with an open RELP session. The responses of
+// the drain are read by a separate goroutine that closes done when the
+// connection fails.
+type relpSession struct {
+	conn net.Conn
+	done chan struct{}
+	err  error
+}
+
+// NewRELPWriter creates a new RELP syslog writer. The connection uses TLS if
+// tlsConf is set.
+func NewRELPWriter(
+	binding *URLBinding,
+	netConf NetworkTimeoutConfig,
+	tlsConf *tls.Config,
+	egressMetric metrics.Counter,
+	droppedMetric metrics.Counter,
+	c MessageConverter,
+	appLogClient v2.LogClient,
+) *RELPWriter {
+	dialer := &net.Dialer{
+		Timeout:   netConf.DialTimeout,
+		KeepAlive: netConf.Keepalive,
+	}
+	df := func(addr string) (net.Conn, error) {
+		if tlsConf != nil {
+			return tls.DialWithDialer(dialer, "tcp", addr, tlsConf)
+		}
+		return dialer.Dial("tcp", addr)
+	}
+
+	return &RELPWriter{
+		url:             binding.URL,
+		appID:           binding.AppID,
+		hostname:        binding.Hostname,
+		dialFunc:        df,
+		writeTimeout:    netConf.WriteTimeout,
+		window:          relpWindowSize,
+		syslogConverter: c,
+		egressMetric:    egressMetric,
+		droppedMetric:   droppedMetric,
+		appLogClient:    appLogClient,
+		acked:           make(chan struct{}, 1),
+	}
+}
+
+// Write sends an envelope to the RELP drain. It blocks while the window of
+// unacknowledged messages is full.
+func (w *RELPWriter) Write(env *loggregator_v2.Envelope) error {
+	s, err := w.connection()
+	if err != nil {
+		return err
+	}
+
+	msgs, err := w.syslogConverter.Convert(env, w.hostname)
+	if err != nil {
+		return err
+	}
+
+	var sent []int
+	for _, msg := range msgs {
+		txnr, err := w.send(s, bytes.TrimSuffix(msg, []byte("\n")))
+		if txnr != 0 {
+			sent = append(sent, txnr)
+		}
+		if err != nil {
+			w.closeSession()
+			// The envelope is written again by the retry writer, so none
+			// of its messages may be sent again after reconnecting.
+			w.mu.Lock()
+			w.pending = slices.DeleteFunc(w.pending, func(p relpFrame) bool { return slices.Contains(sent, p.txnr) })
+			w.mu.Unlock()
+			return err
+		}
+	}
+
+	return nil
+}
+
+// send adds the message to the pending messages and writes it to the drain.
+// It returns the transaction number of the message if it is pending.
+func (w *RELPWriter) send(s *relpSession, msg []byte) (int, error) {
+	if err := w.waitForWindow(s); err != nil {
+		return 0, err
+	}
+
+	f := relpFrame{txnr: w.nextTxnr(), msg: msg}
+	w.mu.Lock()
+	w.pending = append(w.pending, f)
+	w.mu.Unlock()
+
+	return f.txnr, w.writeFrames(s.conn, appendRELPFrame(nil, f.txnr, "syslog", f.msg))
+}
+
+// waitForWindow blocks until fewer messages than the window size are
+// unacknowledged.
+func (w *RELPWriter) waitForWindow(s *relpSession) error {
+	timer := time.NewTimer(w.writeTimeout)
+	defer timer.Stop()
+
+	for {
+		w.mu.Lock()
+		n := len(w.pending)
+		w.mu.Unlock()
+		if n < w.window {
+			return nil
+		}
+
+		select {
+		case <-w.acked:
+		case <-s.done:
+			return s.err
+		case <-timer.C:
+			return errRELPWindowTimeout
+		}
+	}
+}
+
+func (w *RELPWriter) connection() (*relpSession, error) {
+	if w.session != nil {
+		select {
+		case <-w.session.done:
+			log.Printf("RELP session to %s for application %s failed: %s", w.url.Host, w.appID, w.session.err) //nolint:gosec
+			w.closeSession()
+		default:
+			return w.session, nil
+		}
+	}
+	return w.connect()
+}
+
+// connect opens a new session and sends the messages that were not
+// acknowledged in the previous session again.
+func (w *RELPWriter) connect() (*relpSession, error) {
+	conn, err := w.dialFunc(w.url.Host)
+	if err != nil {
+		appLogMessage := fmt.Sprintf("Failed to connect to %s", redactedURL(w.url).String())
+		v2.EmitAppLog(w.appLogClient, appLogMessage, w.appID)
+		platformLogMessage := fmt.Sprintf("%s for app %s", appLogMessage, w.appID)
+		log.Print(platformLogMessage)
+		return nil, err
+	}
+
+	w.txnr = 0
+	r := bufio.NewReader(conn)
+	if err := w.open(conn, r); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	s := &relpSession{conn: conn, done: make(chan struct{})}
+	w.session = s
+	go w.readResponses(s, r)
+
+	log.Printf("created conn to relp drain: %s", w.url.Host) //nolint:gosec
+
+	w.mu.Lock()
+	var resend []byte
+	for i := range w.pending {
+		w.pending[i].txnr = w.nextTxnr()
+		resend = appendRELPFrame(resend, w.pending[i].txnr, "syslog", w.pending[i].msg)
+	}
+	w.mu.Unlock()
+
+	if len(resend) > 0 {
+		if err := w.writeFrames(conn, resend); err != nil {
+			w.closeSession()
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// open negotiates a session with the drain.
+func (w *RELPWriter) open(conn net.Conn, r *bufio.Reader) error {
+	txnr := w.nextTxnr()
+	if err := w.writeFrames(conn, appendRELPFrame(nil, txnr, "open", []byte(relpOffers))); err != nil {
+		return err
+	}
+
+	if err := conn.SetReadDeadline(time.Now().Add(w.writeTimeout)); err != nil {
+		return err
+	}
+	rspTxnr, command, data, err := readRELPFrame(r)
+	if err != nil {
+		return err
+	}
+	if rspTxnr != txnr || command != "rsp" || relpStatus(data) != 200 {
+		return fmt.Errorf("RELP drain refused session: %q", data)
+	}
+
+	return conn.SetReadDeadline(time.Time{})
+}
+
+// readResponses acknowledges messages until the connection fails or the
+// drain closes the session.
+func (w *RELPWriter) readResponses(s *relpSession, r *bufio.Reader) {
+	defer close(s.done)
+
+	for {
+		txnr, command, data, err := readRELPFrame(r)
+		if err != nil {
+			s.err = err
+			return
+		}
+
+		switch command {
+		case "rsp":
+			w.acknowledge(txnr, data)
+		case "serverclose":
+			s.err = errRELPServerClose
+			return
+		}
+	}
+}
+
+func (w *RELPWriter) acknowledge(txnr int, data []byte) {
+	w.mu.Lock()
+	i := slices.IndexFunc(w.pending, func(f relpFrame) bool { return f.txnr == txnr })
+	if i < 0 {
+		w.mu.Unlock()
+		return
+	}
+	w.pending = slices.Delete(w.pending, i, i+1)
+	w.mu.Unlock()
+
+	if relpStatus(data) == 200 {
+		w.egressMetric.Add(1)
+	} else {
+		w.droppedMetric.Add(1)
+		log.Printf("RELP drain %s for application %s rejected a message, dropping it: %q", w.url.Host, w.appID, data) //nolint:gosec
+	}
+
+	select {
+	case w.acked <- struct{}{}:
+	default:
+	}
+}
+
+func (w *RELPWriter) writeFrames(conn net.Conn, b []byte) error {
+	if err := conn.SetWriteDeadline(time.Now().Add(w.writeTimeout)); err != nil {
+		return err
+	}
+	_, err := conn.Write(b)
+	return err
+}
+
+func (w *RELPWriter) nextTxnr() int {
+	w.txnr = w.txnr%relpMaxTxnr + 1
+	return w.txnr
+}
+
+// closeSession closes the connection and waits for the response reader to
+// stop, so that it does not acknowledge messages of the next session.
+func (w *RELPWriter) closeSession() {
+	if w.session == nil {
+		return
+	}
+	_ = w.session.conn.Close()
+	<-w.session.done
+	w.session = nil
+}
+
+// Close waits up to the write timeout for the drain to acknowledge pending
+// messages and closes the session. Messages that are still unacknowledged
+// are dropped.
+func (w *RELPWriter) Close() error {
+	defer w.dropPending()
+
+	s := w.session
+	if s == nil {
+		return nil
+	}
+
+	if err := w.waitForAcknowledgements(s); err != nil {
+		log.Printf("closing RELP session to %s for application %s with unacknowledged messages: %s", w.url.Host, w.appID, err) //nolint:gosec
+	}
+	err := w.writeFrames(s.conn, appendRELPFrame(nil, w.nextTxnr(), "close", nil))
+	w.closeSession()
+
+	return err
+}
+
+func (w *RELPWriter) dropPending() {
+	w.mu.Lock()
+	n := len(w.pending)
+	w.pending = nil
+	w.mu.Unlock()
+
+	if n > 0 {
+		w.droppedMetric.Add(float64(n))
+	}
+}
+
+func (w *RELPWriter) waitForAcknowledgements(s *relpSession) error {
+	timer := time.NewTimer(w.writeTimeout)
+	defer timer.Stop()
+
+	for {
+		w.mu.Lock()
+		n := len(w.pending)
+		w.mu.Unlock()
+		if n == 0 {
+			return nil
+		}
+
+		select {
+		case <-w.acked:
+		case <-s.done:
+			return s.err
+		case <-timer.C:
+			return errRELPWindowTimeout
+		}
+	}
+}
+
+// appendRELPFrame appends a frame of the form "TXNR COMMAND DATALEN DATA\n"
+// to b. The data and the space before it are omitted if there is no data.
+func appendRELPFrame(b []byte, txnr int, command string, data []byte) []byte {
+	b = strconv.AppendInt(b, int64(txnr), 10)
+	b = append(b, ' ')
+	b = append(b, command...)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, int64(len(data)), 10)
+	if len(data) > 0 {
+		b = append(b, ' ')
+		b = append(b, data...)
+	}
+	return append(b, '\n')
+}
+
+func readRELPFrame(r *bufio.Reader) (int, string, []byte, error) {
+	txnrToken, sep, err := readRELPToken(r)
+	if err != nil {
+		return 0, "", nil, err
+	}
+	txnr, err := strconv.Atoi(txnrToken)
+	if err != nil || sep != ' ' {
+		return 0, "", nil, errMalformedRELPFrame
+	}
+
+	command, sep, err := readRELPToken(r)
+	if err != nil {
+		return 0, "", nil, err
+	}
+	if sep != ' ' {
+		return 0, "", nil, errMalformedRELPFrame
+	}
+
+	lenToken, sep, err := readRELPToken(r)
+	if err != nil {
+		return 0, "", nil, err
+	}
+	n, err := strconv.Atoi(lenToken)
+	if err != nil || n < 0 || n > relpMaxResponseSize {
+		return 0, "", nil, errMalformedRELPFrame
+	}
+	if n == 0 {
+		if sep != '\n' {
+			return 0, "", nil, errMalformedRELPFrame
+		}
+		return txnr, command, nil, nil
+	}
+	if sep != ' ' {
+		return 0, "", nil, errMalformedRELPFrame
+	}
+
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, "", nil, err
+	}
+	if trailer, err := r.ReadByte(); err != nil || trailer != '\n' {
+		return 0, "", nil, errMalformedRELPFrame
+	}
+
+	return txnr, command, data, nil
+}
+
+// readRELPToken reads a header field of a frame and the separator that
+// follows it.
+func readRELPToken(r *bufio.Reader) (string, byte, error) {
+	var b []byte
+	for len(b) <= 32 {
+		c, err := r.ReadByte()
+		if err != nil {
+			return "", 0, err
+		}
+		if c == ' ' || c == '\n' {
+			return string(b), c, nil
+		}
+		b = append(b, c)
+	}
+	return "", 0, errMalformedRELPFrame
+}
+
+// relpStatus returns the status code of response data such as "200 OK".
+func relpStatus(data []byte) int {
+	code, err := strconv.Atoi(string(data[:min(3, len(data))]))
+	if err != nil {
+		return 0
+	}
+	return code
+}
@@ -0,0 +1,342 @@
+package syslog_test
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	"code.cloudfoundry.org/loggregator-agent-release/src/internal/testhelper"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RELPWriter", func() {
+	var (
+		listener       net.Listener
+		sessions       chan testRELPSession
+		egressCounter  *metricsHelpers.SpyMetric
+		droppedCounter *metricsHelpers.SpyMetric
+		logClient      *testhelper.SpyLogClient
+		binding        *syslog.URLBinding
+		netConf        = syslog.NetworkTimeoutConfig{
+			WriteTimeout: time.Second,
+			DialTimeout:  time.Second,
+		}
+		env = buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
+	)
+
+	const message = `<14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [APP/2] - [tags@47450 source_type="APP"] just a test`
+
+	// startListener accepts connections and answers the open command of
+	// every session with openResponse.
+	startListener := func(l net.Listener, scheme, openResponse string) {
+		listener = l
+		sessions = make(chan testRELPSession, 4)
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				r := bufio.NewReader(conn)
+
+				f, err := readTestRELPFrame(r)
+				if err != nil || f.command != "open" {
+					conn.Close()
+					continue
+				}
+				_, _ = fmt.Fprintf(conn, "%d rsp %d %s\n", f.txnr, len(openResponse), openResponse)
+
+				sessions <- testRELPSession{conn: conn, r: r, open: f}
+			}
+		}()
+
+		u, err := url.Parse(fmt.Sprintf("%s://%s", scheme, l.Addr()))
+		Expect(err).ToNot(HaveOccurred())
+		binding = &syslog.URLBinding{
+			AppID:    "test-app-id",
+			Hostname: "test-hostname",
+			URL:      u,
+		}
+	}
+
+	BeforeEach(func() {
+		egressCounter = &metricsHelpers.SpyMetric{}
+		droppedCounter = &metricsHelpers.SpyMetric{}
+		logClient = testhelper.NewSpyLogClient()
+		l, err := net.Listen("tcp", "127.0.0.1:")
+		Expect(err).ToNot(HaveOccurred())
+		startListener(l, "relp", "200 OK\nrelp_version=0\ncommands=syslog")
+	})
+
+	AfterEach(func() {
+		listener.Close()
+	})
+
+	newWriter := func(tlsConf *tls.Config) *syslog.RELPWriter {
+		return syslog.NewRELPWriter(
+			binding,
+			netConf,
+			tlsConf,
+			egressCounter,
+			droppedCounter,
+			syslog.NewConverter(),
+			logClient,
+		)
+	}
+
+	acceptSession := func() (net.Conn, *bufio.Reader) {
+		var s testRELPSession
+		EventuallyWithOffset(1, sessions).Should(Receive(&s))
+		return s.conn, s.r
+	}
+
+	readFrame := func(r *bufio.Reader) testRELPFrame {
+		f, err := readTestRELPFrame(r)
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		return f
+	}
+
+	It("counts messages as egressed when the drain acknowledges them", func() {
+		writer := newWriter(nil)
+		defer writer.Close()
+
+		Expect(writer.Write(env)).To(Succeed())
+
+		var s testRELPSession
+		Eventually(sessions).Should(Receive(&s))
+		Expect(s.open.data).To(ContainSubstring("commands=syslog"))
+		conn, r := s.conn, s.r
+		f := readFrame(r)
+		Expect(f.command).To(Equal("syslog"))
+		Expect(f.data).To(Equal(message))
+		Consistently(egressCounter.Value, 50*time.Millisecond).Should(BeZero())
+
+		writeTestRELPFrame(conn, f.txnr, "rsp", "200 OK")
+		Eventually(egressCounter.Value).Should(BeNumerically("==", 1))
+	})
+
+	It("does not count rejected messages as egressed", func() {
+		writer := newWriter(nil)
+		defer writer.Close()
+
+		Expect(writer.Write(env)).To(Succeed())
+		Expect(writer.Write(env)).To(Succeed())
+
+		conn, r := acceptSession()
+		rejected := readFrame(r)
+		acked := readFrame(r)
+		writeTestRELPFrame(conn, rejected.txnr, "rsp", "500 error")
+		writeTestRELPFrame(conn, acked.txnr, "rsp", "200 OK")
+
+		Eventually(egressCounter.Value).Should(BeNumerically("==", 1))
+		Consistently(egressCounter.Value, 50*time.Millisecond).Should(BeNumerically("==", 1))
+		Expect(droppedCounter.Value()).To(BeNumerically("==", 1))
+	})
+
+	It("sends unacknowledged messages again after reconnecting", func() {
+		writer := newWriter(nil)
+		defer writer.Close()
+
+		first := buildLogEnvelope("APP", "2", "first", loggregator_v2.Log_OUT)
+		Expect(writer.Write(first)).To(Succeed())
+
+		conn, r := acceptSession()
+		Expect(readFrame(r).data).To(HaveSuffix("first"))
+		conn.Close()
+
+		second := buildLogEnvelope("APP", "2", "second", loggregator_v2.Log_OUT)
+		Eventually(func() int {
+			_ = writer.Write(second)
+			return len(sessions)
+		}).Should(BeNumerically(">", 0))
+
+		conn, r = acceptSession()
+		resent := readFrame(r)
+		Expect(resent.txnr).To(Equal(2))
+		Expect(resent.data).To(HaveSuffix("first"))
+		Expect(egressCounter.Value()).To(BeZero())
+
+		writeTestRELPFrame(conn, resent.txnr, "rsp", "200 OK")
+		Eventually(egressCounter.Value).Should(BeNumerically("==", 1))
+	})
+
+	It("fails writes while the window of unacknowledged messages is full", func() {
+		netConf.WriteTimeout = 100 * time.Millisecond
+		defer func() { netConf.WriteTimeout = time.Second }()
+		writer := newWriter(nil)
+		defer writer.Close()
+
+		Expect(writer.Write(env)).To(Succeed())
+		_, r := acceptSession()
+		go func() {
+			_, _ = io.Copy(io.Discard, r)
+		}()
+
+		for range 127 {
+			Expect(writer.Write(env)).To(Succeed())
+		}
+		Expect(writer.Write(env)).To(MatchError(ContainSubstring("acknowledgements")))
+	})
+
+	It("does not send the messages of a failed envelope again after reconnecting", func() {
+		netConf.WriteTimeout = 100 * time.Millisecond
+		defer func() { netConf.WriteTimeout = time.Second }()
+		writer := newWriter(nil)
+		defer writer.Close()
+
+		Expect(writer.Write(env)).To(Succeed())
+		_, r := acceptSession()
+		go func() {
+			_, _ = io.Copy(io.Discard, r)
+		}()
+		for range 125 {
+			Expect(writer.Write(env)).To(Succeed())
+		}
+
+		// Two of the messages of the gauge fit into the window.
+		Expect(writer.Write(buildGaugeEnvelope("1"))).To(MatchError(ContainSubstring("acknowledgements")))
+
+		after := buildLogEnvelope("APP", "2", "after", loggregator_v2.Log_OUT)
+		Expect(writer.Write(after)).To(Succeed())
+		_, resent := acceptSession()
+		for i := range 126 {
+			f := readFrame(resent)
+			Expect(f.txnr).To(Equal(i + 2))
+			Expect(f.data).To(Equal(message))
+		}
+		Expect(readFrame(resent).data).To(HaveSuffix("after"))
+	})
+
+	It("returns an error if the drain refuses the session", func() {
+		listener.Close()
+		l, err := net.Listen("tcp", "127.0.0.1:")
+		Expect(err).ToNot(HaveOccurred())
+		startListener(l, "relp", "500 busy")
+
+		writer := newWriter(nil)
+		defer writer.Close()
+
+		Expect(writer.Write(env)).To(MatchError(ContainSubstring("500 busy")))
+	})
+
+	It("closes the session after pending messages are acknowledged", func() {
+		writer := newWriter(nil)
+
+		Expect(writer.Write(env)).To(Succeed())
+		conn, r := acceptSession()
+		f := readFrame(r)
+
+		closed := make(chan error)
+		go func() {
+			closed <- writer.Close()
+		}()
+		Consistently(closed, 50*time.Millisecond).ShouldNot(Receive())
+
+		writeTestRELPFrame(conn, f.txnr, "rsp", "200 OK")
+		Expect(readFrame(r).command).To(Equal("close"))
+		Eventually(closed).Should(Receive(BeNil()))
+		Expect(egressCounter.Value()).To(BeNumerically("==", 1))
+		Expect(droppedCounter.Value()).To(BeZero())
+	})
+
+	It("counts messages that are unacknowledged on close as dropped", func() {
+		netConf.WriteTimeout = 100 * time.Millisecond
+		defer func() { netConf.WriteTimeout = time.Second }()
+		writer := newWriter(nil)
+
+		Expect(writer.Write(env)).To(Succeed())
+		Expect(writer.Write(env)).To(Succeed())
+		_, r := acceptSession()
+		readFrame(r)
+		readFrame(r)
+
+		Expect(writer.Close()).To(Succeed())
+		Expect(egressCounter.Value()).To(BeZero())
+		Expect(droppedCounter.Value()).To(BeNumerically("==", 2))
+	})
+
+	It("does not leak credentials when it fails to connect", func() {
+		addr := listener.Addr().String()
+		listener.Close()
+		u, err := url.Parse(fmt.Sprintf("relp://user:secret@%s/?token=query-secret", addr))
+		Expect(err).ToNot(HaveOccurred())
+		binding.URL = u
+
+		writer := newWriter(nil)
+		defer writer.Close()
+
+		Expect(writer.Write(env)).ToNot(Succeed())
+		Expect(logClient.Message()).To(HaveLen(1))
+		Expect(logClient.Message()[0]).ToNot(ContainSubstring("secret"))
+	})
+
+	It("speaks TLS", func() {
+		listener.Close()
+		testCerts := testhelper.GenerateCerts("loggregatorCA")
+		tlsCert, err := tls.LoadX509KeyPair(testCerts.Cert("metron"), testCerts.Key("metron"))
+		Expect(err).ToNot(HaveOccurred())
+		l, err := tls.Listen("tcp", "127.0.0.1:", &tls.Config{Certificates: []tls.Certificate{tlsCert}}) //nolint:gosec
+		Expect(err).ToNot(HaveOccurred())
+		startListener(l, "relp-tls", "200 OK")
+
+		writer := newWriter(&tls.Config{InsecureSkipVerify: true}) //nolint:gosec
+		defer writer.Close()
+
+		Expect(writer.Write(env)).To(Succeed())
+		conn, r := acceptSession()
+		f := readFrame(r)
+		writeTestRELPFrame(conn, f.txnr, "rsp", "200 OK")
+
+		Eventually(egressCounter.Value).Should(BeNumerically("==", 1))
+	})
+})
+
+type testRELPSession struct {
+	conn net.Conn
+	r    *bufio.Reader
+	open testRELPFrame
+}
+
+type testRELPFrame struct {
+	txnr    int
+	command string
+	data    string
+}
+
+func readTestRELPFrame(r *bufio.Reader) (testRELPFrame, error) {
+	var f testRELPFrame
+	var n int
+	if _, err := fmt.Fscanf(r, "%d %s %d", &f.txnr, &f.command, &n); err != nil {
+		return f, err
+	}
+
+	if n > 0 {
+		if sep, err := r.ReadByte(); err != nil || sep != ' ' {
+			return f, fmt.Errorf("missing space before data: %v", err)
+		}
+		data := make([]byte, n)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return f, err
+		}
+		f.data = string(data)
+	}
+
+	if trailer, err := r.ReadByte(); err != nil || trailer != '\n' {
+		return f, fmt.Errorf("missing trailer: %v", err)
+	}
+
+	return f, nil
+}
+
+func writeTestRELPFrame(w io.Writer, txnr int, command, data string) {
+	_, err := fmt.Fprintf(w, "%d %s %d %s\n", txnr, command, len(data), data)
+	Expect(err).ToNot(HaveOccurred())
+}
@@ -37,22 +37,34 @@ func NewRetryWriter(
 	}, nil
 }
 
-// Write will retry writes unitl maxRetries has been reached.
+// Write will retry writes unitl maxRetries has been reached. Envelopes are
+// dropped without an error while the circuit breaker of the binding is open.
 func (r *RetryWriter) Write(e *loggregator_v2.Envelope) error {
 	logTemplate := "failed to write to %s, retrying in %s, err: %s"
 
 	var err error
 
+	cb := r.binding.CircuitBreaker
+	if !cb.Allow(1) {
+		return nil
+	}
+
 	for i := 0; i < r.maxRetries; i++ {
 		err = r.Writer.Write(e)
 		if err == nil {
+			cb.Success()
 			return nil
 		}
+		cb.Failure()
 
 		if egress.ContextDone(r.binding.Context) {
 			return err
 		}
 
+		if !cb.Allow(1) {
+			return nil
+		}
+
 		sleepDuration := r.retryDuration(i)
 		log.Printf(logTemplate, r.binding.URL.Host, sleepDuration, err) //nolint:gosec
 
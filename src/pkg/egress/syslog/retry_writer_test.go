@@ -7,6 +7,7 @@ import (
 	"time"
 
 	v2 "code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
 	"context"
@@ -88,6 +89,30 @@ var _ = Describe("Retry Writer", func() {
 		})
 	})
 
+	Describe("with a circuit breaker", func() {
+		It("drops envelopes without writing while the breaker is open", func() {
+			dropped := &metricsHelpers.SpyMetric{}
+			binding := &syslog.URLBinding{
+				URL:            &url.URL{},
+				Context:        context.Background(),
+				CircuitBreaker: syslog.NewCircuitBreaker(2, time.Minute, dropped, nil),
+			}
+			writeCloser := &spyWriteCloser{
+				returnErrCount: 10,
+				writeErr:       errors.New("write error"),
+			}
+			r, err := buildRetryWriter(writeCloser, binding, 5, 0)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(r.Write(&v2.Envelope{})).To(Succeed())
+			Expect(writeCloser.WriteAttempts()).To(Equal(2))
+
+			Expect(r.Write(&v2.Envelope{})).To(Succeed())
+			Expect(writeCloser.WriteAttempts()).To(Equal(2))
+			Expect(dropped.Value()).To(BeNumerically("==", 2))
+		})
+	})
+
 	Describe("Close()", func() {
 		It("delegates to the syslog writer", func() {
 			binding := &syslog.URLBinding{
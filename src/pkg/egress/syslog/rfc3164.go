@@ -0,0 +1,158 @@
+package syslog
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+)
+
+// RFC3164TimeFormat is the BSD syslog timestamp, e.g. "Jan  2 15:04:05".
+const RFC3164TimeFormat = time.Stamp
+
+// defaultRFC3164Priority is used for log types that do not map to a
+// severity, as RFC 3164 does not allow for a negative PRI.
+const defaultRFC3164Priority = 13
+
+// maxRFC3164TagLength is the maximum length of the TAG, see RFC 3164
+// section 4.1.3.
+const maxRFC3164TagLength = 32
+
+// RFC3164Converter serializes envelopes as BSD syslog messages
+// (<PRI>Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG). The hostname and process ID
+// are derived the same way as for RFC5424. As RFC 3164 has no structured
+// data, metrics and events are rendered as key=value pairs.
+type RFC3164Converter struct {
+	*Converter
+}
+
+func NewRFC3164Converter(opts ...ConverterOption) *RFC3164Converter {
+	return &RFC3164Converter{
+		Converter: NewConverter(opts...),
+	}
+}
+
+func (c *RFC3164Converter) Convert(env *loggregator_v2.Envelope, defaultHostname string) ([][]byte, error) {
+	return c.ToRFC3164(env, defaultHostname)
+}
+
+func (c *RFC3164Converter) ToRFC3164(env *loggregator_v2.Envelope, defaultHostname string) ([][]byte, error) {
+	hostname := c.nilify(c.BuildHostname(env, defaultHostname))
+	tag := c.sanitizeProcID(c.BuildAppName(env))
+	if len(tag) > maxRFC3164TagLength {
+		// The sanitized tag only contains ASCII characters.
+		tag = tag[:maxRFC3164TagLength]
+	}
+	tag = c.nilify(tag)
+
+	switch env.GetMessage().(type) {
+	case *loggregator_v2.Envelope_Log:
+		return [][]byte{c.toRFC3164LogMessage(env, hostname, tag)}, nil
+	case *loggregator_v2.Envelope_Gauge:
+		return c.toRFC3164GaugeMessages(env, hostname, tag), nil
+	case *loggregator_v2.Envelope_Timer:
+		timer := env.GetTimer()
+		return [][]byte{c.toRFC3164MetricMessage(env, hostname, tag, [][2]string{
+			{"timer", timer.GetName()},
+			{"start", strconv.FormatInt(timer.GetStart(), 10)},
+			{"stop", strconv.FormatInt(timer.GetStop(), 10)},
+		})}, nil
+	case *loggregator_v2.Envelope_Counter:
+		counter := env.GetCounter()
+		return [][]byte{c.toRFC3164MetricMessage(env, hostname, tag, [][2]string{
+			{"counter", counter.GetName()},
+			{"total", strconv.FormatUint(counter.GetTotal(), 10)},
+			{"delta", strconv.FormatUint(counter.GetDelta(), 10)},
+		})}, nil
+	case *loggregator_v2.Envelope_Event:
+		event := env.GetEvent()
+		return [][]byte{c.toRFC3164MetricMessage(env, hostname, tag, [][2]string{
+			{"event", event.GetTitle()},
+			{"body", event.GetBody()},
+		})}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func (c *RFC3164Converter) toRFC3164LogMessage(env *loggregator_v2.Envelope, hostname, tag string) []byte {
+	priority := c.genPriority(env.GetLog().Type)
+	if priority < 0 {
+		priority = defaultRFC3164Priority
+	}
+	pid := generateProcessID(
+		c.sanitizeProcID(env.Tags["source_type"]),
+		env.InstanceId,
+	)
+
+	return append(
+		c.header(priority, env, hostname, tag, pid),
+		appendNewline(removeNulls(env.GetLog().Payload))...,
+	)
+}
+
+func (c *RFC3164Converter) toRFC3164GaugeMessages(env *loggregator_v2.Envelope, hostname, tag string) [][]byte {
+	metrics := env.GetGauge().GetMetrics()
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	msgs := make([][]byte, 0, len(names))
+	for _, name := range names {
+		g := metrics[name]
+		msgs = append(msgs, c.toRFC3164MetricMessage(env, hostname, tag, [][2]string{
+			{"gauge", name},
+			{"value", strconv.FormatFloat(g.GetValue(), 'g', -1, 64)},
+			{"unit", g.GetUnit()},
+		}))
+	}
+
+	return msgs
+}
+
+func (c *RFC3164Converter) toRFC3164MetricMessage(env *loggregator_v2.Envelope, hostname, tag string, fields [][2]string) []byte {
+	msg := c.header(14, env, hostname, tag, "["+env.InstanceId+"]")
+
+	for i, f := range fields {
+		if i > 0 {
+			msg = append(msg, ' ')
+		}
+		msg = appendKeyValue(msg, f[0], f[1])
+	}
+
+	if !c.omitTags {
+		keys := make([]string, 0, len(env.GetTags()))
+		for k := range env.GetTags() {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			msg = append(msg, ' ')
+			msg = appendKeyValue(msg, k, env.GetTags()[k])
+		}
+	}
+
+	return append(msg, '\n')
+}
+
+func (c *RFC3164Converter) header(priority int, env *loggregator_v2.Envelope, hostname, tag, pid string) []byte {
+	ts := time.Unix(0, env.GetTimestamp()).UTC().Format(RFC3164TimeFormat)
+	return fmt.Appendf(nil, "<%d>%s %s %s%s: ", priority, ts, hostname, tag, pid)
+}
+
+// appendKeyValue appends key=value to msg, quoting the value if it would
+// otherwise be ambiguous.
+func appendKeyValue(msg []byte, key, value string) []byte {
+	msg = append(msg, removeNulls([]byte(key))...)
+	msg = append(msg, '=')
+	if value == "" || strings.ContainsAny(value, " \t\r\n\"=") {
+		return strconv.AppendQuote(msg, value)
+	}
+	return append(msg, removeNulls([]byte(value))...)
+}
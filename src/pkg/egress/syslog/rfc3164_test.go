@@ -0,0 +1,136 @@
+package syslog_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+)
+
+var _ = Describe("RFC3164", func() {
+	var (
+		c *syslog.RFC3164Converter
+	)
+
+	BeforeEach(func() {
+		c = syslog.NewRFC3164Converter()
+	})
+
+	It("converts a log envelope to a BSD syslog message", func() {
+		env := buildLogEnvelope("MY TASK", "2", "just a test", loggregator_v2.Log_OUT)
+
+		Expect(c.ToRFC3164(env, "test-hostname")).To(Equal([][]byte{
+			[]byte("<14>Jan  1 00:00:00 test-hostname test-app-id[MY-TASK/2]: just a test\n"),
+		}))
+	})
+
+	It("uses the correct priority for STDERR", func() {
+		env := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_ERR)
+
+		Expect(c.ToRFC3164(env, "test-hostname")).To(Equal([][]byte{
+			[]byte("<11>Jan  1 00:00:00 test-hostname test-app-id[APP/2]: just a test\n"),
+		}))
+	})
+
+	It("uses a valid priority for unknown log types", func() {
+		env := buildLogEnvelope("APP", "2", "just a test", 20)
+
+		Expect(c.ToRFC3164(env, "test-hostname")).To(Equal([][]byte{
+			[]byte("<13>Jan  1 00:00:00 test-hostname test-app-id[APP/2]: just a test\n"),
+		}))
+	})
+
+	It("builds the hostname from org, space, and app name tags", func() {
+		env := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
+		env.Tags["organization_name"] = "some-org"
+		env.Tags["space_name"] = "some space"
+		env.Tags["app_name"] = "some_app"
+
+		Expect(c.ToRFC3164(env, "test-hostname")).To(Equal([][]byte{
+			[]byte("<14>Jan  1 00:00:00 some-org.some-space.someapp test-app-id[APP/2]: just a test\n"),
+		}))
+	})
+
+	It("uses the app name template for the tag", func() {
+		c = syslog.NewRFC3164Converter(syslog.WithAppNameTemplate("{app_name}"))
+		env := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
+		env.Tags["organization_name"] = "some-org"
+		env.Tags["space_name"] = "some-space"
+		env.Tags["app_name"] = "some_app"
+
+		Expect(c.ToRFC3164(env, "test-hostname")).To(Equal([][]byte{
+			[]byte("<14>Jan  1 00:00:00 some-org.some-space.someapp some_app[APP/2]: just a test\n"),
+		}))
+	})
+
+	It("truncates the tag to 32 characters", func() {
+		env := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
+		env.SourceId = "2f6c5e6a-0a8e-4a5b-9d3c-6f1e2d7b8a90"
+
+		Expect(c.ToRFC3164(env, "test-hostname")).To(Equal([][]byte{
+			[]byte("<14>Jan  1 00:00:00 test-hostname 2f6c5e6a-0a8e-4a5b-9d3c-6f1e2d7b[APP/2]: just a test\n"),
+		}))
+	})
+
+	It("converts a gauge envelope to key=value messages", func() {
+		env := buildGaugeEnvelope("1")
+
+		Expect(c.ToRFC3164(env, "test-hostname")).To(Equal([][]byte{
+			[]byte("<14>Jan  1 00:00:00 test-hostname test-app-id[1]: gauge=cpu value=0.23 unit=percentage\n"),
+			[]byte("<14>Jan  1 00:00:00 test-hostname test-app-id[1]: gauge=disk value=1234 unit=bytes\n"),
+			[]byte("<14>Jan  1 00:00:00 test-hostname test-app-id[1]: gauge=disk_quota value=1024 unit=bytes\n"),
+			[]byte("<14>Jan  1 00:00:00 test-hostname test-app-id[1]: gauge=memory value=5423 unit=bytes\n"),
+			[]byte("<14>Jan  1 00:00:00 test-hostname test-app-id[1]: gauge=memory_quota value=8000 unit=bytes\n"),
+		}))
+	})
+
+	It("converts a counter envelope to a key=value message", func() {
+		env := buildCounterEnvelope("1")
+
+		Expect(c.ToRFC3164(env, "test-hostname")).To(Equal([][]byte{
+			[]byte("<14>Jan  1 00:00:00 test-hostname test-app-id[1]: counter=some-counter total=99 delta=1\n"),
+		}))
+	})
+
+	It("converts a timer envelope to a key=value message", func() {
+		env := buildTimerEnvelope("1")
+
+		Expect(c.ToRFC3164(env, "test-hostname")).To(Equal([][]byte{
+			[]byte("<14>Jan  1 00:00:00 test-hostname test-app-id[1]: timer=http start=10 stop=20\n"),
+		}))
+	})
+
+	It("converts an event envelope to a key=value message and quotes values", func() {
+		env := buildEventEnvelope("1")
+		env.GetEvent().Body = "some event body"
+
+		Expect(c.ToRFC3164(env, "test-hostname")).To(Equal([][]byte{
+			[]byte(`<14>Jan  1 00:00:00 test-hostname test-app-id[1]: event=event-title body="some event body"` + "\n"),
+		}))
+	})
+
+	It("appends tags to metric messages", func() {
+		env := buildCounterEnvelope("1")
+		env.Tags = map[string]string{"b": "2", "a": "has space"}
+
+		Expect(c.ToRFC3164(env, "test-hostname")).To(Equal([][]byte{
+			[]byte(`<14>Jan  1 00:00:00 test-hostname test-app-id[1]: counter=some-counter total=99 delta=1 a="has space" b=2` + "\n"),
+		}))
+	})
+
+	It("has the option to omit tags", func() {
+		c = syslog.NewRFC3164Converter(syslog.WithoutSyslogMetadata())
+		env := buildCounterEnvelope("1")
+		env.Tags = map[string]string{"a": "1"}
+
+		Expect(c.ToRFC3164(env, "test-hostname")).To(Equal([][]byte{
+			[]byte("<14>Jan  1 00:00:00 test-hostname test-app-id[1]: counter=some-counter total=99 delta=1\n"),
+		}))
+	})
+
+	It("is selected by the RFC3164 format", func() {
+		Expect(syslog.NewMessageConverter(syslog.FormatRFC3164)).To(BeAssignableToTypeOf(&syslog.RFC3164Converter{}))
+		Expect(syslog.NewMessageConverter(syslog.FormatRFC5424)).To(BeAssignableToTypeOf(&syslog.Converter{}))
+	})
+})
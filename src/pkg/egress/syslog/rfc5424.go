@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
 
 	"code.cloudfoundry.org/go-loggregator/v10/rfc5424"
 )
@@ -42,8 +43,28 @@ func WithoutSyslogMetadata() ConverterOption {
 	}
 }
 
+// WithCombinedGauges renders all values of a gauge envelope as a single
+// message. RFC 5424 does not allow an SD-ID to appear more than once in a
+// message, so the values are added to one gauge@47450 element with indexed
+// parameter names, e.g. name.1, value.1 and unit.1.
+func WithCombinedGauges() ConverterOption {
+	return func(c *Converter) {
+		c.combineGauges = true
+	}
+}
+
 type Converter struct {
-	omitTags bool
+	omitTags      bool
+	combineGauges bool
+	sampleRate    float64
+
+	hostnameTemplate headerTemplate
+	appNameTemplate  headerTemplate
+
+	maxMessageSize    int
+	oversizedMessages OversizedMessages
+	splitMetric       metrics.Counter
+	truncatedMetric   metrics.Counter
 }
 
 func NewConverter(opts ...ConverterOption) *Converter {
@@ -56,10 +77,14 @@ func NewConverter(opts ...ConverterOption) *Converter {
 	return c
 }
 
+func (c *Converter) Convert(env *loggregator_v2.Envelope, defaultHostname string) ([][]byte, error) {
+	return c.ToRFC5424(env, defaultHostname)
+}
+
 func (c *Converter) ToRFC5424(env *loggregator_v2.Envelope, defaultHostname string) ([][]byte, error) {
 	hostname := c.BuildHostname(env, defaultHostname)
 
-	appID := env.GetSourceId()
+	appID := c.BuildAppName(env)
 
 	switch env.GetMessage().(type) {
 	case *loggregator_v2.Envelope_Log:
@@ -78,6 +103,12 @@ func (c *Converter) ToRFC5424(env *loggregator_v2.Envelope, defaultHostname stri
 }
 
 func (c *Converter) BuildHostname(env *loggregator_v2.Envelope, defaultHostname string) string {
+	if c.hostnameTemplate != nil {
+		if hostname := c.templatedHostname(env); hostname != "" {
+			return hostname
+		}
+	}
+
 	hostname := defaultHostname
 
 	envTags := env.GetTags()
@@ -117,6 +148,10 @@ func (c *Converter) toRFC5424CounterMessage(env *loggregator_v2.Envelope, hostna
 }
 
 func (c *Converter) toRFC5424GaugeMessage(env *loggregator_v2.Envelope, hostname, appID string) ([][]byte, error) {
+	if c.combineGauges {
+		return c.toRFC5424CombinedGaugeMessage(env, hostname, appID)
+	}
+
 	gauges := make([][]byte, 0, 5)
 
 	for name, g := range env.GetGauge().GetMetrics() {
@@ -131,6 +166,30 @@ func (c *Converter) toRFC5424GaugeMessage(env *loggregator_v2.Envelope, hostname
 	return gauges, nil
 }
 
+func (c *Converter) toRFC5424CombinedGaugeMessage(env *loggregator_v2.Envelope, hostname, appID string) ([][]byte, error) {
+	values := env.GetGauge().GetMetrics()
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	params := make([]rfc5424.SDParam, 0, 3*len(names))
+	for i, name := range names {
+		g := values[name]
+		index := strconv.Itoa(i + 1)
+		params = append(params,
+			rfc5424.SDParam{Name: "name." + index, Value: name},
+			rfc5424.SDParam{Name: "value." + index, Value: strconv.FormatFloat(g.GetValue(), 'g', -1, 64)},
+			rfc5424.SDParam{Name: "unit." + index, Value: g.GetUnit()},
+		)
+	}
+
+	sd := rfc5424.StructuredData{ID: gaugeStructuredDataID, Parameters: params}
+	messageBinary, err := c.toRFC5424MetricMessage(env, hostname, appID, sd)
+	return [][]byte{messageBinary}, err
+}
+
 func (c *Converter) toRFC5424TimerMessage(env *loggregator_v2.Envelope, hostname, appID string) ([][]byte, error) {
 	timer := env.GetTimer()
 	sd := rfc5424.StructuredData{ID: timerStructuredDataID, Parameters: []rfc5424.SDParam{{Name: "name", Value: timer.GetName()}, {Name: "start", Value: strconv.FormatInt(timer.GetStart(), 10)}, {Name: "stop", Value: strconv.FormatInt(timer.GetStop(), 10)}}}
@@ -162,6 +221,9 @@ func (c *Converter) toRFC5424LogMessage(env *loggregator_v2.Envelope, hostname,
 	if baseSD.ID != "" {
 		structuredDatas = append(structuredDatas, baseSD)
 	}
+	if c.sampleRate > 0 {
+		structuredDatas = append(structuredDatas, c.sampledStructuredData())
+	}
 	message := rfc5424.Message{
 		Priority:       rfc5424.Priority(priority),
 		Timestamp:      ts,
@@ -171,9 +233,8 @@ func (c *Converter) toRFC5424LogMessage(env *loggregator_v2.Envelope, hostname,
 		Message:        msg,
 		StructuredData: structuredDatas,
 	}
-	messageBinary, err := message.MarshalBinary()
 
-	return [][]byte{messageBinary}, err
+	return c.fitLogMessage(message)
 }
 
 func (c *Converter) buildTagsStructuredData(tags map[string]string) rfc5424.StructuredData {
@@ -212,6 +273,9 @@ func (c *Converter) toRFC5424MetricMessage(env *loggregator_v2.Envelope, hostnam
 	if baseSD.ID != "" {
 		structuredDatas = append(structuredDatas, baseSD)
 	}
+	if c.sampleRate > 0 {
+		structuredDatas = append(structuredDatas, c.sampledStructuredData())
+	}
 	message := rfc5424.Message{
 		Priority:       rfc5424.Priority(priority),
 		Timestamp:      ts,
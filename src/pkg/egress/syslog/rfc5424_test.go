@@ -58,6 +58,33 @@ var _ = Describe("RFC5424", func() {
 		))
 	})
 
+	It("has the option to combine the values of a gauge envelope in a single message", func() {
+		c = syslog.NewConverter(syslog.WithCombinedGauges())
+		env := buildGaugeEnvelope("1")
+
+		Expect(c.ToRFC5424(env, "test-hostname")).To(Equal([][]byte{
+			[]byte("<14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [1] - [gauge@47450 " +
+				"name.1=\"cpu\" value.1=\"0.23\" unit.1=\"percentage\" " +
+				"name.2=\"disk\" value.2=\"1234\" unit.2=\"bytes\" " +
+				"name.3=\"disk_quota\" value.3=\"1024\" unit.3=\"bytes\" " +
+				"name.4=\"memory\" value.4=\"5423\" unit.4=\"bytes\" " +
+				"name.5=\"memory_quota\" value.5=\"8000\" unit.5=\"bytes\"] \n"),
+		}))
+	})
+
+	It("has the option to mark messages with the sample rate", func() {
+		c = syslog.NewConverter(syslog.WithSampleRate(0.25))
+
+		logEnv := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
+		receivedMsgs, err := c.ToRFC5424(logEnv, "test-hostname")
+		Expect(err).ToNot(HaveOccurred())
+		expectConversion(receivedMsgs, `<14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [APP/2] - [tags@47450 source_type="APP"][sampled@47450 rate="0.25"] just a test`+"\n")
+
+		receivedMsgs, err = c.ToRFC5424(buildCounterEnvelope("1"), "test-hostname")
+		Expect(err).ToNot(HaveOccurred())
+		expectConversion(receivedMsgs, `<14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [1] - [counter@47450 name="some-counter" total="99" delta="1"][sampled@47450 rate="0.25"] `+"\n")
+	})
+
 	It("converts a counter envelope to a slice of slice of byte in RFC5424 format", func() {
 		env := buildCounterEnvelope("1")
 
@@ -146,6 +173,48 @@ var _ = Describe("RFC5424", func() {
 		expectConversion(receivedMsgs, `<11>1 1970-01-01T00:00:00.012345+00:00 someorg.some-space.someapp test-app-id [MY-TASK/2] - [tags@47450 app_name="some_app--" organization_name="some_org" source_type="MY TASK" space_name="some space"] just a test`+"\n")
 	})
 
+	Describe("header templates", func() {
+		It("renders the hostname and app name from tags", func() {
+			c = syslog.NewConverter(
+				syslog.WithHostnameTemplate("{deployment}.{job}-{index}"),
+				syslog.WithAppNameTemplate("{source_id} {instance_id}"),
+			)
+			logEnv := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_ERR)
+			logEnv.Tags["deployment"] = "cf"
+			logEnv.Tags["job"] = "diego_cell"
+			logEnv.Tags["index"] = "0"
+			logEnv.Tags["instance_id"] = "7"
+
+			receivedMsgs, err := c.ToRFC5424(logEnv, "test-hostname")
+			Expect(err).ToNot(HaveOccurred())
+			expectConversion(receivedMsgs, `<11>1 1970-01-01T00:00:00.012345+00:00 cf.diegocell-0 test-app-id-7 [APP/2] - [tags@47450 deployment="cf" index="0" instance_id="7" job="diego_cell" source_type="APP"] just a test`+"\n")
+		})
+
+		It("falls back to the defaults if the templates render empty values", func() {
+			c = syslog.NewConverter(
+				syslog.WithHostnameTemplate("{deployment}"),
+				syslog.WithAppNameTemplate("{app_name}"),
+			)
+			logEnv := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_ERR)
+
+			receivedMsgs, err := c.ToRFC5424(logEnv, "test-hostname")
+			Expect(err).ToNot(HaveOccurred())
+			expectConversion(receivedMsgs, `<11>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [APP/2] - [tags@47450 source_type="APP"] just a test`+"\n")
+		})
+
+		It("keeps literal text and unterminated braces", func() {
+			c = syslog.NewConverter(
+				syslog.WithHostnameTemplate("logs.{source_id}.{"),
+				syslog.WithAppNameTemplate("app-{source_id"),
+			)
+			metricEnv := buildCounterEnvelope("1")
+
+			receivedMsgs, err := c.ToRFC5424(metricEnv, "test-hostname")
+			Expect(err).ToNot(HaveOccurred())
+			expectConversion(receivedMsgs, `<14>1 1970-01-01T00:00:00.012345+00:00 logs.test-app-id app-{source_id [1] - [counter@47450 name="some-counter" total="99" delta="1"] `+"\n")
+		})
+	})
+
 	It("sanitizes the procid field", func() {
 		logEnv := buildLogEnvelope("MY TASK", "2", "just a test", loggregator_v2.Log_ERR)
 		logEnv.Tags["source_type"] = "TASK/こんにちは"
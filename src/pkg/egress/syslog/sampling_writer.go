@@ -0,0 +1,77 @@
+package syslog
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+	"strconv"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rfc5424"
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+)
+
+const sampledStructuredDataID = "sampled@47450"
+
+// SamplingWriter writes a random sample of envelopes. Envelopes with a
+// trace_id tag are sampled by their trace ID, so that either all or none of
+// the envelopes of a trace are written.
+type SamplingWriter struct {
+	writer egress.Writer
+	rate   float64
+}
+
+// NewSamplingWriter returns a writer that writes the given fraction of
+// envelopes.
+func NewSamplingWriter(w egress.Writer, rate float64) *SamplingWriter {
+	return &SamplingWriter{
+		writer: w,
+		rate:   rate,
+	}
+}
+
+func (w *SamplingWriter) Write(env *loggregator_v2.Envelope) error {
+	if !w.sampled(env) {
+		return nil
+	}
+	return w.writer.Write(env)
+}
+
+func (w *SamplingWriter) sampled(env *loggregator_v2.Envelope) bool {
+	traceID, ok := env.GetTags()["trace_id"]
+	if !ok || traceID == "" {
+		return rand.Float64() < w.rate //nolint:gosec
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(traceID))
+	return float64(mix64(h.Sum64()))/math.MaxUint64 < w.rate
+}
+
+// mix64 is the finalizer of MurmurHash3. It spreads the differences between
+// similar trace IDs, which FNV leaves in the low bits, over all bits.
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// WithSampleRate marks messages as part of a sample with the given rate, so
+// that receivers can scale counts back up. RFC 5424 messages carry a
+// sampled@47450 structured data element and JSON messages a sample_rate
+// field.
+func WithSampleRate(rate float64) ConverterOption {
+	return func(c *Converter) {
+		c.sampleRate = rate
+	}
+}
+
+func (c *Converter) sampledStructuredData() rfc5424.StructuredData {
+	return rfc5424.StructuredData{
+		ID:         sampledStructuredDataID,
+		Parameters: []rfc5424.SDParam{{Name: "rate", Value: strconv.FormatFloat(c.sampleRate, 'g', -1, 64)}},
+	}
+}
@@ -0,0 +1,50 @@
+package syslog_test
+
+import (
+	"fmt"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SamplingWriter", func() {
+	var spy *recordingWriteCloser
+
+	BeforeEach(func() {
+		spy = &recordingWriteCloser{}
+	})
+
+	It("writes a uniform sample of envelopes", func() {
+		w := syslog.NewSamplingWriter(spy, 0.1)
+
+		for i := 0; i < 10000; i++ {
+			Expect(w.Write(&loggregator_v2.Envelope{})).To(Succeed())
+		}
+
+		Expect(len(spy.envelopes())).To(BeNumerically("~", 1000, 150))
+	})
+
+	It("samples all or none of the envelopes of a trace", func() {
+		w := syslog.NewSamplingWriter(spy, 0.5)
+
+		sampledTraces := 0
+		for i := 0; i < 200; i++ {
+			traceID := fmt.Sprintf("%032x", i)
+			written := len(spy.envelopes())
+			for j := 0; j < 5; j++ {
+				Expect(w.Write(&loggregator_v2.Envelope{Tags: map[string]string{"trace_id": traceID}})).To(Succeed())
+			}
+
+			switch len(spy.envelopes()) - written {
+			case 5:
+				sampledTraces++
+			case 0:
+			default:
+				Fail("trace " + traceID + " was sampled partially")
+			}
+		}
+		Expect(sampledTraces).To(BeNumerically("~", 100, 30))
+	})
+})
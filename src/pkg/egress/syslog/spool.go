@@ -0,0 +1,358 @@
+package syslog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	metrics "code.cloudfoundry.org/go-metric-registry"
+)
+
+const spoolFileExt = ".batch"
+
+var errSpoolFull = errors.New("spool is full")
+
+// Spool persists batches that could not be delivered to batching HTTP
+// drains (https-batch, loki, elasticsearch, opensearch and splunk-hec) so
+// that they can be replayed once the drain recovers. Every drain gets its
+// own directory below the spool directory. Spooled batches survive restarts
+// and count towards the limits until they are replayed, or until the
+// directory of the drain is removed because the drain was not opened again
+// within the grace period.
+type Spool struct {
+	dir              string
+	maxBytes         int64
+	maxBytesPerDrain int64
+	gracePeriod      time.Duration
+
+	mu      sync.Mutex
+	bytes   int64
+	drains  map[string]*drainSpool
+	orphans map[string]*time.Timer
+}
+
+// NewSpool creates the spool directory if necessary and accounts for all
+// batches that are already spooled in it. The directories of drains that are
+// not opened within gracePeriod are removed.
+func NewSpool(dir string, maxBytes, maxBytesPerDrain int64, gracePeriod time.Duration) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	s := &Spool{
+		dir:              dir,
+		maxBytes:         maxBytes,
+		maxBytesPerDrain: maxBytesPerDrain,
+		gracePeriod:      gracePeriod,
+		drains:           make(map[string]*drainSpool),
+		orphans:          make(map[string]*time.Timer),
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		size, err := spooledBytes(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		s.bytes += size
+		s.orphan(e.Name())
+	}
+
+	return s, nil
+}
+
+// spooledBytes returns the size of all batches in the directory of a drain.
+func spooledBytes(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != spoolFileExt {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
+
+// spoolKey identifies the spool directory of a binding. It is derived from
+// the full drain URL, which may contain credentials, and is therefore hashed.
+// The URL includes the query, so that batches encoded with other drain
+// parameters are not replayed. The spool of a drain whose URL changed is
+// removed after the grace period.
+func spoolKey(b *URLBinding) string {
+	sum := sha256.Sum256([]byte(b.AppID + " " + b.URL.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// open returns the spool of a single drain. Writers for the same drain share
+// a drainSpool until all of them have released it.
+func (s *Spool) open(key string, batchesMetric, bytesMetric metrics.Gauge) (*drainSpool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ds, ok := s.drains[key]; ok {
+		ds.refs++
+		return ds, nil
+	}
+
+	if t, ok := s.orphans[key]; ok {
+		t.Stop()
+		delete(s.orphans, key)
+	}
+
+	ds := &drainSpool{
+		spool:         s,
+		key:           key,
+		dir:           filepath.Join(s.dir, key),
+		refs:          1,
+		batchesMetric: batchesMetric,
+		bytesMetric:   bytesMetric,
+	}
+	if err := ds.load(); err != nil {
+		s.orphan(key)
+		return nil, err
+	}
+	s.drains[key] = ds
+
+	return ds, nil
+}
+
+// release gives up the spool of a drain. Once the last writer released it,
+// the directory of the drain is removed unless the drain is opened again
+// within the grace period.
+func (s *Spool) release(ds *drainSpool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ds.refs--
+	if ds.refs == 0 {
+		delete(s.drains, ds.key)
+		s.orphan(ds.key)
+	}
+}
+
+// orphan schedules the removal of the directory of a drain that is not
+// open. It must be called with s.mu held.
+func (s *Spool) orphan(key string) {
+	var t *time.Timer
+	t = time.AfterFunc(s.gracePeriod, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if s.orphans[key] != t {
+			return
+		}
+		delete(s.orphans, key)
+
+		dir := filepath.Join(s.dir, key)
+		size, err := spooledBytes(dir)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Failed to read spool directory %s, err: %s", dir, err)
+			return
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			log.Printf("Failed to remove spool directory %s, err: %s", dir, err)
+			return
+		}
+		s.bytes -= size
+	})
+	s.orphans[key] = t
+}
+
+// reserve claims size bytes of the global limit.
+func (s *Spool) reserve(size int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.bytes+size > s.maxBytes {
+		return false
+	}
+	s.bytes += size
+	return true
+}
+
+func (s *Spool) free(size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bytes -= size
+}
+
+type spooledBatch struct {
+	path string
+	size int64
+}
+
+// drainSpool is the FIFO of spooled batches of a single drain. Every batch is
+// stored in its own file, prefixed with its message count.
+type drainSpool struct {
+	spool *Spool
+	key   string
+	dir   string
+	refs  int // guarded by spool.mu
+
+	// replayMu ensures that only one writer replays the spool at a time.
+	replayMu sync.Mutex
+
+	mu      sync.Mutex
+	batches []spooledBatch
+	bytes   int64
+	nextSeq uint64
+
+	batchesMetric metrics.Gauge
+	bytesMetric   metrics.Gauge
+}
+
+func (d *drainSpool) load() error {
+	if err := os.MkdirAll(d.dir, 0700); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return err
+	}
+
+	// Entries are sorted by name and therefore by sequence number.
+	for _, e := range entries {
+		path := filepath.Join(d.dir, e.Name())
+		if filepath.Ext(path) != spoolFileExt {
+			// Leftovers of interrupted writes.
+			_ = os.Remove(path)
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(e.Name(), spoolFileExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return err
+		}
+		d.batches = append(d.batches, spooledBatch{path: path, size: info.Size()})
+		d.bytes += info.Size()
+		d.nextSeq = seq + 1
+	}
+	d.updateMetrics()
+
+	return nil
+}
+
+func (d *drainSpool) len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.batches)
+}
+
+// push appends a batch to the spool. It returns errSpoolFull if the batch
+// would exceed the limit of the drain or the global limit.
+func (d *drainSpool) push(batch []byte, msgCount float64) error {
+	data := make([]byte, 0, len(batch)+16)
+	data = strconv.AppendFloat(data, msgCount, 'f', -1, 64)
+	data = append(data, '\n')
+	data = append(data, batch...)
+	size := int64(len(data))
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.bytes+size > d.spool.maxBytesPerDrain || !d.spool.reserve(size) {
+		return errSpoolFull
+	}
+
+	path := filepath.Join(d.dir, fmt.Sprintf("%020d%s", d.nextSeq, spoolFileExt))
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		_ = os.Remove(tmpPath)
+		d.spool.free(size)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		d.spool.free(size)
+		return err
+	}
+
+	d.nextSeq++
+	d.batches = append(d.batches, spooledBatch{path: path, size: size})
+	d.bytes += size
+	d.updateMetrics()
+
+	return nil
+}
+
+// peek returns the oldest batch without removing it from the spool. ok is
+// false if the spool is empty.
+func (d *drainSpool) peek() (batch []byte, msgCount float64, ok bool, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.batches) == 0 {
+		return nil, 0, false, nil
+	}
+
+	data, err := os.ReadFile(d.batches[0].path)
+	if err != nil {
+		return nil, 0, true, err
+	}
+	header, batch, found := bytes.Cut(data, []byte("\n"))
+	if !found {
+		return nil, 0, true, fmt.Errorf("missing header in %s", d.batches[0].path)
+	}
+	msgCount, err = strconv.ParseFloat(string(header), 64)
+	if err != nil {
+		return nil, 0, true, err
+	}
+
+	return batch, msgCount, true, nil
+}
+
+// pop removes the oldest batch from the spool. The batch is removed even if
+// its file can not be deleted so that it is not replayed twice.
+func (d *drainSpool) pop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.batches) == 0 {
+		return
+	}
+
+	b := d.batches[0]
+	d.batches = d.batches[1:]
+	if err := os.Remove(b.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("Failed to remove spooled batch %s, err: %s", b.path, err)
+	}
+	d.bytes -= b.size
+	d.spool.free(b.size)
+	d.updateMetrics()
+}
+
+func (d *drainSpool) updateMetrics() {
+	d.batchesMetric.Set(float64(len(d.batches)))
+	d.bytesMetric.Set(float64(d.bytes))
+}
@@ -0,0 +1,186 @@
+package syslog_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Spool", func() {
+	var (
+		netConf          syslog.NetworkTimeoutConfig
+		skipSSLTLSConfig = &tls.Config{
+			InsecureSkipVerify: true, //nolint:gosec
+		}
+		c             = syslog.NewConverter()
+		sendInterval  = 50 * time.Millisecond
+		dir           string
+		drain         *rawDrain
+		batchesMetric *metricsHelpers.SpyMetric
+		bytesMetric   *metricsHelpers.SpyMetric
+	)
+
+	newWriter := func(spool *syslog.Spool, u string) egress.WriteCloser {
+		w := syslog.NewHTTPSBatchWriter(
+			buildURLBinding(u, "test-app-id", "test-hostname"),
+			netConf,
+			skipSSLTLSConfig,
+			&metricsHelpers.SpyMetric{},
+			c,
+			syslog.WithSendInterval(sendInterval),
+			syslog.WithSpool(spool, "drain", batchesMetric, bytesMetric),
+		)
+		w.(syslog.InternalRetryWriter).ConfigureRetry(func(int) time.Duration { return 0 }, 0)
+		return w
+	}
+
+	expectedBody := func(payload string) string {
+		msgs, err := c.ToRFC5424(buildLogEnvelope("APP", "1", payload, loggregator_v2.Log_OUT), "test-hostname")
+		Expect(err).ToNot(HaveOccurred())
+		return string(msgs[0])
+	}
+
+	bodies := func() []string {
+		var bs []string
+		for _, b := range drain.getBodies() {
+			bs = append(bs, string(b))
+		}
+		return bs
+	}
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		drain = newRawMockDrain(http.StatusServiceUnavailable)
+		batchesMetric = &metricsHelpers.SpyMetric{}
+		bytesMetric = &metricsHelpers.SpyMetric{}
+	})
+
+	It("spools failed batches and replays them in order once the drain recovers", func() {
+		spool, err := syslog.NewSpool(dir, 1024*1024, 1024*1024, time.Hour)
+		Expect(err).ToNot(HaveOccurred())
+		writer := newWriter(spool, drain.URL)
+		defer writer.Close()
+
+		Expect(writer.Write(buildLogEnvelope("APP", "1", "message 1", loggregator_v2.Log_OUT))).To(Succeed())
+		Eventually(batchesMetric.Value).Should(BeNumerically("==", 1))
+		Expect(writer.Write(buildLogEnvelope("APP", "1", "message 2", loggregator_v2.Log_OUT))).To(Succeed())
+		Eventually(batchesMetric.Value).Should(BeNumerically("==", 2))
+		Expect(bytesMetric.Value()).To(BeNumerically(">", 0))
+
+		drain.setStatus(http.StatusOK)
+		Expect(writer.Write(buildLogEnvelope("APP", "1", "message 3", loggregator_v2.Log_OUT))).To(Succeed())
+
+		Eventually(bodies).Should(Equal([]string{
+			expectedBody("message 1"),
+			expectedBody("message 2"),
+			expectedBody("message 3"),
+		}))
+		Eventually(batchesMetric.Value).Should(BeNumerically("==", 0))
+		Expect(bytesMetric.Value()).To(BeNumerically("==", 0))
+	})
+
+	It("replays batches that were spooled before a restart", func() {
+		spool, err := syslog.NewSpool(dir, 1024*1024, 1024*1024, time.Hour)
+		Expect(err).ToNot(HaveOccurred())
+		writer := newWriter(spool, drain.URL)
+		Expect(writer.Write(buildLogEnvelope("APP", "1", "message 1", loggregator_v2.Log_OUT))).To(Succeed())
+		Eventually(batchesMetric.Value).Should(BeNumerically("==", 1))
+		Expect(writer.Close()).To(Succeed())
+
+		drain.setStatus(http.StatusOK)
+		spool, err = syslog.NewSpool(dir, 1024*1024, 1024*1024, time.Hour)
+		Expect(err).ToNot(HaveOccurred())
+		writer = newWriter(spool, drain.URL)
+		defer writer.Close()
+
+		Eventually(bodies).Should(Equal([]string{expectedBody("message 1")}))
+		Eventually(batchesMetric.Value).Should(BeNumerically("==", 0))
+	})
+
+	It("drops batches that exceed the limit of a drain", func() {
+		spool, err := syslog.NewSpool(dir, 1024*1024, 10, time.Hour)
+		Expect(err).ToNot(HaveOccurred())
+		writer := newWriter(spool, drain.URL)
+		defer writer.Close()
+
+		Expect(writer.Write(buildLogEnvelope("APP", "1", "message 1", loggregator_v2.Log_OUT))).To(Succeed())
+		Eventually(drain.getRequestCount).Should(BeNumerically(">=", 1))
+		Consistently(batchesMetric.Value, 5*sendInterval).Should(BeNumerically("==", 0))
+	})
+
+	It("drops batches that exceed the global limit", func() {
+		spool, err := syslog.NewSpool(dir, 200, 1024*1024, time.Hour)
+		Expect(err).ToNot(HaveOccurred())
+		writer := newWriter(spool, drain.URL)
+		defer writer.Close()
+
+		Expect(writer.Write(buildLogEnvelope("APP", "1", "message 1", loggregator_v2.Log_OUT))).To(Succeed())
+		Eventually(batchesMetric.Value).Should(BeNumerically("==", 1))
+
+		otherBatches := &metricsHelpers.SpyMetric{}
+		otherWriter := syslog.NewHTTPSBatchWriter(
+			buildURLBinding(drain.URL, "other-app-id", "test-hostname"),
+			netConf,
+			skipSSLTLSConfig,
+			&metricsHelpers.SpyMetric{},
+			c,
+			syslog.WithSendInterval(sendInterval),
+			syslog.WithSpool(spool, "other", otherBatches, &metricsHelpers.SpyMetric{}),
+		)
+		defer otherWriter.Close()
+
+		Expect(otherWriter.Write(buildLogEnvelope("APP", "1", "message 2", loggregator_v2.Log_OUT))).To(Succeed())
+		Consistently(otherBatches.Value, 5*sendInterval).Should(BeNumerically("==", 0))
+	})
+
+	It("removes the spool of drains that are not opened again within the grace period", func() {
+		spool, err := syslog.NewSpool(dir, 1024*1024, 1024*1024, time.Hour)
+		Expect(err).ToNot(HaveOccurred())
+		writer := newWriter(spool, drain.URL)
+		Expect(writer.Write(buildLogEnvelope("APP", "1", "message 1", loggregator_v2.Log_OUT))).To(Succeed())
+		Eventually(batchesMetric.Value).Should(BeNumerically("==", 1))
+		Expect(writer.Close()).To(Succeed())
+
+		spool, err = syslog.NewSpool(dir, 200, 1024*1024, 5*sendInterval)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(os.ReadDir(dir)).To(HaveLen(1))
+		Eventually(func() ([]os.DirEntry, error) { return os.ReadDir(dir) }).Should(BeEmpty())
+
+		otherBatches := &metricsHelpers.SpyMetric{}
+		otherWriter := syslog.NewHTTPSBatchWriter(
+			buildURLBinding(drain.URL, "other-app-id", "test-hostname"),
+			netConf,
+			skipSSLTLSConfig,
+			&metricsHelpers.SpyMetric{},
+			c,
+			syslog.WithSendInterval(sendInterval),
+			syslog.WithSpool(spool, "other", otherBatches, &metricsHelpers.SpyMetric{}),
+		)
+		defer otherWriter.Close()
+
+		Expect(otherWriter.Write(buildLogEnvelope("APP", "1", "message 2", loggregator_v2.Log_OUT))).To(Succeed())
+		Eventually(otherBatches.Value).Should(BeNumerically("==", 1))
+	})
+
+	It("keeps the spool of drains that are opened again within the grace period", func() {
+		spool, err := syslog.NewSpool(dir, 1024*1024, 1024*1024, 5*sendInterval)
+		Expect(err).ToNot(HaveOccurred())
+		writer := newWriter(spool, drain.URL)
+		Expect(writer.Write(buildLogEnvelope("APP", "1", "message 1", loggregator_v2.Log_OUT))).To(Succeed())
+		Eventually(batchesMetric.Value).Should(BeNumerically("==", 1))
+		Expect(writer.Close()).To(Succeed())
+
+		writer = newWriter(spool, drain.URL)
+		defer writer.Close()
+		Consistently(func() ([]os.DirEntry, error) { return os.ReadDir(dir) }, 10*sendInterval).Should(HaveLen(1))
+		Expect(batchesMetric.Value()).To(BeNumerically("==", 1))
+	})
+})
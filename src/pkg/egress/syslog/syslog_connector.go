@@ -3,6 +3,9 @@ package syslog
 import (
 	"fmt"
 	"log"
+	"regexp"
+	"slices"
+	"time"
 
 	"context"
 
@@ -19,6 +22,53 @@ type Binding struct {
 	DrainData    DrainData `json:"type,omitempty"`
 	OmitMetadata bool
 	InternalTls  bool
+	Framing      Framing
+	Format       Format
+	Compression  Compression
+	// RateLimit is the number of envelopes per second that are written to
+	// the drain. Envelopes exceeding it are dropped. 0 disables the limit.
+	RateLimit int
+	// Burst is the number of envelopes that may exceed RateLimit at once.
+	Burst int
+	// Connections is the number of connections opened to syslog and
+	// syslog-tls drains.
+	Connections int
+	// MaxMessageSize is the maximum size of RFC 5424 log messages. 0
+	// disables the limit.
+	MaxMessageSize    int
+	OversizedMessages OversizedMessages
+	// CombineGauges renders all values of a gauge envelope as a single
+	// RFC 5424 message.
+	CombineGauges bool
+	// HostnameTemplate and AppNameTemplate override the HOSTNAME and
+	// APP-NAME of messages with values rendered from envelope tags.
+	HostnameTemplate string
+	AppNameTemplate  string
+	// CoalesceWindow is the time in which continuation lines are merged into
+	// the previous log of the same source and instance. 0 disables
+	// coalescing.
+	CoalesceWindow time.Duration
+	// CoalescePattern matches additional continuation lines.
+	CoalescePattern string
+	// SampleRate is the fraction of envelopes that are written to the drain.
+	// 0 disables sampling.
+	SampleRate float64
+	// IncludeSourceTypes and ExcludeSourceTypes are comma separated lists
+	// of source types, such as APP or RTR, whose logs are written to or
+	// excluded from the drain. A source type also matches the components
+	// of nested source types, such as PROC for APP/PROC/WEB.
+	IncludeSourceTypes string
+	ExcludeSourceTypes string
+	// LogType selects the logs written to the drain by their stream.
+	LogType LogType
+	// MetricsInclude and MetricsExclude are comma separated lists of glob
+	// patterns for the names of counters and gauge metrics written to or
+	// excluded from the drain.
+	MetricsInclude string
+	MetricsExclude string
+	// Redact is a comma separated list of the names of redaction rules that
+	// are applied to log payloads, or "all".
+	Redact string
 }
 
 type Drain struct {
@@ -30,6 +80,9 @@ type Credentials struct {
 	Cert string `json:"cert"`
 	Key  string `json:"key"`
 	CA   string `json:"ca"`
+	// Username and Password authenticate with drains that support SASL.
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"` //nolint:gosec
 }
 
 type writerFactory interface {
@@ -46,6 +99,10 @@ type SyslogConnector struct {
 	droppedMetric metrics.Counter
 
 	logClient v2.LogClient
+
+	rateLimitReportInterval time.Duration
+
+	redactionRules []RedactionRule
 }
 
 // NewSyslogConnector configures and returns a new SyslogConnector.
@@ -69,6 +126,9 @@ func NewSyslogConnector(
 
 		metricClient:  m,
 		droppedMetric: droppedMetric,
+
+		rateLimitReportInterval: time.Minute,
+		redactionRules:          BuiltinRedactionRules(),
 	}
 	for _, o := range opts {
 		o(sc)
@@ -87,10 +147,70 @@ func WithLogClient(logClient v2.LogClient) ConnectorOption {
 	}
 }
 
+// WithRateLimitReportInterval returns a ConnectorOption that sets how often
+// applications are informed about envelopes dropped by rate limits.
+func WithRateLimitReportInterval(d time.Duration) ConnectorOption {
+	return func(sc *SyslogConnector) {
+		sc.rateLimitReportInterval = d
+	}
+}
+
+// WithRedactionRules returns a ConnectorOption that makes redaction rules
+// available to drains in addition to the built-in ones. Rules replace
+// built-in rules of the same name.
+func WithRedactionRules(rules ...RedactionRule) ConnectorOption {
+	return func(sc *SyslogConnector) {
+		for _, r := range rules {
+			i := slices.IndexFunc(sc.redactionRules, func(b RedactionRule) bool { return b.Name == r.Name })
+			if i < 0 {
+				sc.redactionRules = append(sc.redactionRules, r)
+				continue
+			}
+			sc.redactionRules[i] = r
+		}
+	}
+}
+
 // Connect returns an egress writer based on the scheme of the binding drain
 // URL.
-func (w *SyslogConnector) Connect(ctx context.Context, b Binding) (egress.Writer, error) {
-	urlBinding, err := buildBinding(ctx, b)
+func (w *SyslogConnector) Connect(ctx context.Context, b Binding) (_ egress.Writer, err error) {
+	// The binding is validated before any writer is started, as a failed
+	// connect is attempted again for the next envelope.
+	if !b.DrainData.valid() {
+		return nil, errInvalidBindingType
+	}
+	var rules []RedactionRule
+	if b.Redact != "" {
+		rules, err = SelectRedactionRules(w.redactionRules, b.Redact)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var pattern *regexp.Regexp
+	if b.CoalescePattern != "" {
+		pattern, err = regexp.Compile(b.CoalescePattern)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The coalescing writer writes its pending logs once ctx is done. The
+	// writers behind it are stopped after that so that the logs are not lost.
+	// Everything started for the drain is stopped if it fails to connect.
+	var downstreamCtx context.Context
+	var stopDownstream context.CancelFunc
+	if b.CoalesceWindow > 0 {
+		downstreamCtx, stopDownstream = context.WithCancel(context.WithoutCancel(ctx))
+	} else {
+		downstreamCtx, stopDownstream = context.WithCancel(ctx)
+	}
+	defer func() {
+		if err != nil {
+			stopDownstream()
+		}
+	}()
+
+	urlBinding, err := buildBinding(downstreamCtx, b)
 	if err != nil {
 		return nil, err
 	}
@@ -119,7 +239,7 @@ func (w *SyslogConnector) Connect(ctx context.Context, b Binding) (egress.Writer
 		}),
 	)
 
-	dw := egress.NewDiodeWriter(ctx, writer, diodes.AlertFunc(func(missed int) {
+	dw := egress.NewDiodeWriter(downstreamCtx, writer, diodes.AlertFunc(func(missed int) {
 		w.droppedMetric.Add(float64(missed))
 		drainDroppedMetric.Add(float64(missed))
 
@@ -127,7 +247,70 @@ func (w *SyslogConnector) Connect(ctx context.Context, b Binding) (egress.Writer
 		v2.EmitAppLog(w.logClient, fmt.Sprintf("%d messages lost for application %s in user provided syslog drain with url %s", missed, b.AppId, anonymousUrl.String()), b.AppId)
 	}), w.wg)
 
-	filteredWriter, err := NewFilteringDrainWriter(b, dw)
+	var rw egress.Writer = dw
+	if b.RateLimit > 0 {
+		rw = NewRateLimitWriter(downstreamCtx, dw, b.RateLimit, b.Burst, w.rateLimitReportInterval,
+			func(dropped int) {
+				w.droppedMetric.Add(float64(dropped))
+				drainDroppedMetric.Add(float64(dropped))
+			},
+			func(discarded int) {
+				msg := fmt.Sprintf("%d messages discarded for application %s in the last %s because syslog drain with url %s exceeded its rate limit of %d messages per second", discarded, b.AppId, w.rateLimitReportInterval, anonymousUrl.String(), b.RateLimit)
+				v2.EmitAppLog(w.logClient, msg, b.AppId)
+				log.Print(msg)
+			},
+		)
+	}
+
+	// Logs are sampled after they are coalesced so that multi-line logs are
+	// sampled as a whole.
+	if b.SampleRate > 0 {
+		rw = NewSamplingWriter(rw, b.SampleRate)
+	}
+
+	if b.CoalesceWindow > 0 {
+		coalesceCtx, stopCoalescing := context.WithCancel(ctx)
+		defer func() {
+			if err != nil {
+				stopCoalescing()
+			}
+		}()
+		cw := NewCoalescingWriter(coalesceCtx, rw, b.CoalesceWindow, pattern)
+		go func() {
+			<-cw.Stopped()
+			stopDownstream()
+		}()
+		rw = cw
+	}
+
+	if len(rules) > 0 {
+		counters := make([]metrics.Counter, 0, len(rules))
+		for _, r := range rules {
+			counters = append(counters, w.metricClient.NewCounter(
+				"redactions",
+				"Total number of redactions in log payloads.",
+				metrics.WithMetricLabels(map[string]string{
+					"direction":   "egress",
+					"drain_scope": drainScope,
+					"drain_url":   anonymousUrl.String(),
+					"rule":        r.Name,
+				}),
+			))
+		}
+		rw = NewRedactingWriter(rw, rules, counters)
+	}
+
+	filteredMetric := w.metricClient.NewCounter(
+		"messages_filtered_per_drain",
+		"Total number of envelopes not written to the drain because of its source type, stream or metric name filters.",
+		metrics.WithMetricLabels(map[string]string{
+			"direction":   "egress",
+			"drain_scope": drainScope,
+			"drain_url":   anonymousUrl.String(),
+		}),
+	)
+
+	filteredWriter, err := NewFilteringDrainWriter(b, rw, WithFilteredMetric(filteredMetric))
 	if err != nil {
 		log.Printf("failed to create filtered writer: %s", err)
 		return nil, err
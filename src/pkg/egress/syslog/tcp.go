@@ -6,7 +6,6 @@ import (
 	"log"
 	"net"
 	"net/url"
-	"strconv"
 	"strings"
 	"time"
 
@@ -29,8 +28,9 @@ type TCPWriter struct {
 	dialFunc        DialFunc
 	writeTimeout    time.Duration
 	scheme          string
+	framing         Framing
 	conn            net.Conn
-	syslogConverter *Converter
+	syslogConverter MessageConverter
 
 	egressMetric metrics.Counter
 
@@ -42,7 +42,7 @@ func NewTCPWriter(
 	binding *URLBinding,
 	netConf NetworkTimeoutConfig,
 	egressMetric metrics.Counter,
-	c *Converter,
+	c MessageConverter,
 	appLogClient v2.LogClient,
 ) egress.WriteCloser {
 	dialer := &net.Dialer{
@@ -60,6 +60,7 @@ func NewTCPWriter(
 		writeTimeout:    netConf.WriteTimeout,
 		dialFunc:        df,
 		scheme:          "syslog",
+		framing:         binding.Framing,
 		egressMetric:    egressMetric,
 		syslogConverter: c,
 		appLogClient:    appLogClient,
@@ -75,7 +76,7 @@ func (w *TCPWriter) Write(env *loggregator_v2.Envelope) error {
 		return err
 	}
 
-	msgs, err := w.syslogConverter.ToRFC5424(env, w.hostname)
+	msgs, err := w.syslogConverter.Convert(env, w.hostname)
 	if err != nil {
 		return err
 	}
@@ -87,7 +88,7 @@ func (w *TCPWriter) Write(env *loggregator_v2.Envelope) error {
 			return err
 		}
 
-		_, err = conn.Write([]byte(strconv.Itoa(len(msg)) + " " + string(msg)))
+		_, err = conn.Write(w.framing.frame(msg))
 		if err != nil {
 			_ = w.Close()
 			return err
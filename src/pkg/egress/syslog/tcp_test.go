@@ -184,6 +184,52 @@ var _ = Describe("TCPWriter", func() {
 		})
 	})
 
+	DescribeTable("framing", func(framing syslog.Framing, payload, expected string) {
+		framedBinding := *binding
+		framedBinding.Framing = framing
+		writer := syslog.NewTCPWriter(
+			&framedBinding,
+			netConf,
+			&metricsHelpers.SpyMetric{},
+			syslog.NewConverter(),
+			testhelper.NewSpyLogClient(),
+		)
+		defer writer.Close()
+
+		env := buildLogEnvelope("APP", "2", payload, loggregator_v2.Log_OUT)
+		Expect(writer.Write(env)).To(Succeed())
+
+		conn, err := listener.Accept()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(conn.SetReadDeadline(time.Now().Add(time.Second))).To(Succeed())
+
+		actual := make([]byte, len(expected))
+		_, err = io.ReadFull(conn, actual)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(actual)).To(Equal(expected))
+	},
+		Entry("octet counting",
+			syslog.OctetCounting,
+			"just a test",
+			`118 <14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [APP/2] - [tags@47450 source_type="APP"] just a test`+"\n",
+		),
+		Entry("line feed",
+			syslog.NonTransparentLF,
+			"just a test",
+			`<14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [APP/2] - [tags@47450 source_type="APP"] just a test`+"\n",
+		),
+		Entry("line feed with embedded newlines",
+			syslog.NonTransparentLF,
+			"line one\nline two\n",
+			`<14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [APP/2] - [tags@47450 source_type="APP"] line one\nline two`+"\n",
+		),
+		Entry("null byte",
+			syslog.NonTransparentNUL,
+			"line one\nline two",
+			`<14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [APP/2] - [tags@47450 source_type="APP"] line one`+"\n"+`line two`+"\x00",
+		),
+	)
+
 	Describe("when write fails to connect", func() {
 		It("write returns an error", func() {
 			env := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
@@ -27,7 +27,7 @@ func NewTLSWriter(
 	netConf NetworkTimeoutConfig,
 	tlsConf *tls.Config,
 	egressMetric metrics.Counter,
-	syslogConverter *Converter,
+	syslogConverter MessageConverter,
 	appLogClient v2.LogClient,
 ) egress.WriteCloser {
 
@@ -48,6 +48,7 @@ func NewTLSWriter(
 			writeTimeout:    netConf.WriteTimeout,
 			dialFunc:        df,
 			scheme:          "syslog-tls",
+			framing:         binding.Framing,
 			egressMetric:    egressMetric,
 			syslogConverter: syslogConverter,
 			appLogClient:    appLogClient,
@@ -0,0 +1,197 @@
+package syslog
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"time"
+	"unicode/utf8"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metrics "code.cloudfoundry.org/go-metric-registry"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+	v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/ingress/v2"
+)
+
+const (
+	// maxUDPMessageSize is the largest message that all syslog receivers
+	// SHOULD be able to receive over UDP, see RFC 5426 section 3.2.
+	maxUDPMessageSize = 2048
+	// maxUDPDatagramSize is the largest payload of an IPv4 UDP datagram.
+	maxUDPDatagramSize = 65507
+)
+
+// UDPWriter represents a syslog writer that sends each message as a single
+// UDP datagram as described in RFC 5426. The writer factory splits RFC 5424
+// messages to fit into a datagram, other messages that exceed the maximum
+// message size of the binding, or 2048 bytes if it has none, are truncated.
+// Like the TCPWriter it is not meant to be used from multiple goroutines.
+type UDPWriter struct {
+	url             *url.URL
+	appID           string
+	hostname        string
+	dialFunc        DialFunc
+	writeTimeout    time.Duration
+	maxMessageSize  int
+	datagrams       datagramFunc
+	conn            net.Conn
+	syslogConverter MessageConverter
+
+	egressMetric  metrics.Counter
+	droppedMetric metrics.Counter
+
+	appLogClient v2.LogClient
+}
+
+// datagramFunc splits msg into the datagrams that are sent for it to a drain
+// whose messages must not exceed maxMessageSize. Messages without datagrams
+// are dropped.
+type datagramFunc func(msg []byte, maxMessageSize int) [][]byte
+
+// NewUDPWriter creates a new UDP syslog writer.
+func NewUDPWriter(
+	binding *URLBinding,
+	netConf NetworkTimeoutConfig,
+	egressMetric metrics.Counter,
+	droppedMetric metrics.Counter,
+	c MessageConverter,
+	appLogClient v2.LogClient,
+) egress.WriteCloser {
+	return newUDPWriter(binding, netConf, egressMetric, droppedMetric, c, appLogClient, truncatedDatagram)
+}
+
+func newUDPWriter(
+	binding *URLBinding,
+	netConf NetworkTimeoutConfig,
+	egressMetric metrics.Counter,
+	droppedMetric metrics.Counter,
+	c MessageConverter,
+	appLogClient v2.LogClient,
+	datagrams datagramFunc,
+) *UDPWriter {
+	dialer := &net.Dialer{
+		Timeout: netConf.DialTimeout,
+	}
+	df := func(addr string) (net.Conn, error) {
+		return dialer.Dial("udp", addr)
+	}
+
+	return &UDPWriter{
+		url:             binding.URL,
+		appID:           binding.AppID,
+		hostname:        binding.Hostname,
+		writeTimeout:    netConf.WriteTimeout,
+		maxMessageSize:  udpMessageSize(binding.MaxMessageSize),
+		datagrams:       datagrams,
+		dialFunc:        df,
+		egressMetric:    egressMetric,
+		droppedMetric:   droppedMetric,
+		syslogConverter: c,
+		appLogClient:    appLogClient,
+	}
+}
+
+// Write sends an envelope to the syslog drain. Only failures to resolve the
+// drain address are returned as errors. As UDP gives no delivery guarantees,
+// messages that cannot be sent are counted as dropped rather than retried.
+func (w *UDPWriter) Write(env *loggregator_v2.Envelope) error {
+	conn, err := w.connection()
+	if err != nil {
+		return err
+	}
+
+	msgs, err := w.syslogConverter.Convert(env, w.hostname)
+	if err != nil {
+		return err
+	}
+
+	for i, msg := range msgs {
+		datagrams := w.datagrams(msg, w.maxMessageSize)
+		if len(datagrams) == 0 {
+			log.Printf("message for udp syslog drain %s for application %s is too large, dropping it", redactedURL(w.url), w.appID)
+			w.droppedMetric.Add(1)
+			continue
+		}
+
+		err = conn.SetWriteDeadline(time.Now().Add(w.writeTimeout))
+		for _, d := range datagrams {
+			if err != nil {
+				break
+			}
+			_, err = conn.Write(d)
+		}
+		if err != nil {
+			log.Printf("failed to write to udp syslog drain %s for application %s, dropping %d messages, err: %s", redactedURL(w.url), w.appID, len(msgs)-i, err) //nolint:gosec
+			w.droppedMetric.Add(float64(len(msgs) - i))
+			_ = w.Close()
+			return nil
+		}
+
+		w.egressMetric.Add(1)
+	}
+
+	return nil
+}
+
+func (w *UDPWriter) connection() (net.Conn, error) {
+	if w.conn == nil {
+		return w.connect()
+	}
+	return w.conn, nil
+}
+
+func (w *UDPWriter) connect() (net.Conn, error) {
+	conn, err := w.dialFunc(w.url.Host)
+	if err != nil {
+		appLogMessage := fmt.Sprintf("Failed to connect to %s", redactedURL(w.url).String())
+		v2.EmitAppLog(w.appLogClient, appLogMessage, w.appID)
+		log.Printf("%s for app %s", appLogMessage, w.appID)
+		return nil, err
+	}
+	w.conn = conn
+
+	log.Printf("created udp conn to syslog drain: %s", w.url.Host) //nolint:gosec
+
+	return conn, nil
+}
+
+// Close tears down the socket to the drain.
+func (w *UDPWriter) Close() error {
+	if w.conn != nil {
+		err := w.conn.Close()
+		w.conn = nil
+
+		return err
+	}
+
+	return nil
+}
+
+// udpMessageSize returns the size of the largest message sent to a drain with
+// the given maximum message size in a datagram, 0 being no maximum.
+func udpMessageSize(maxMessageSize int) int {
+	if maxMessageSize == 0 {
+		return maxUDPMessageSize
+	}
+	return min(max(maxMessageSize, MinMessageSize), maxUDPDatagramSize)
+}
+
+// truncatedDatagram returns msg as a single datagram of at most size bytes.
+func truncatedDatagram(msg []byte, size int) [][]byte {
+	return [][]byte{truncateUDPMessage(msg, size)}
+}
+
+// truncateUDPMessage cuts msg down to at most size bytes without splitting a
+// multi-byte UTF-8 sequence.
+func truncateUDPMessage(msg []byte, size int) []byte {
+	if len(msg) <= size {
+		return msg
+	}
+
+	n := size
+	for n > 0 && !utf8.RuneStart(msg[n]) {
+		n--
+	}
+	return msg[:n]
+}
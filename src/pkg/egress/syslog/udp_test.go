@@ -0,0 +1,176 @@
+package syslog_test
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	"code.cloudfoundry.org/loggregator-agent-release/src/internal/testhelper"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
+	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("UDPWriter", func() {
+	var (
+		listener      net.PacketConn
+		binding       *syslog.URLBinding
+		writer        egress.WriteCloser
+		egressCounter *metricsHelpers.SpyMetric
+		droppedMetric *metricsHelpers.SpyMetric
+		netConf       = syslog.NetworkTimeoutConfig{
+			WriteTimeout: time.Second,
+			DialTimeout:  100 * time.Millisecond,
+		}
+	)
+
+	BeforeEach(func() {
+		var err error
+		listener, err = net.ListenPacket("udp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+
+		u, err := url.Parse(fmt.Sprintf("syslog-udp://%s", listener.LocalAddr()))
+		Expect(err).ToNot(HaveOccurred())
+		binding = &syslog.URLBinding{
+			AppID:    "test-app-id",
+			Hostname: "test-hostname",
+			URL:      u,
+		}
+
+		egressCounter = &metricsHelpers.SpyMetric{}
+		droppedMetric = &metricsHelpers.SpyMetric{}
+		writer = syslog.NewUDPWriter(
+			binding,
+			netConf,
+			egressCounter,
+			droppedMetric,
+			syslog.NewConverter(),
+			testhelper.NewSpyLogClient(),
+		)
+	})
+
+	AfterEach(func() {
+		writer.Close()
+		listener.Close()
+	})
+
+	readDatagram := func() string {
+		buf := make([]byte, 65536)
+		Expect(listener.SetReadDeadline(time.Now().Add(time.Second))).To(Succeed())
+		n, _, err := listener.ReadFrom(buf)
+		Expect(err).ToNot(HaveOccurred())
+		return string(buf[:n])
+	}
+
+	It("writes one message per datagram without framing", func() {
+		env := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
+		Expect(writer.Write(env)).To(Succeed())
+
+		Expect(readDatagram()).To(Equal(
+			`<14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [APP/2] - [tags@47450 source_type="APP"] just a test` + "\n",
+		))
+		Expect(egressCounter.Value()).To(BeNumerically("==", 1))
+	})
+
+	It("writes gauge metrics as separate datagrams", func() {
+		env := buildGaugeEnvelope("1")
+		Expect(writer.Write(env)).To(Succeed())
+
+		var msgs []string
+		for i := 0; i < 5; i++ {
+			msgs = append(msgs, readDatagram())
+		}
+		Expect(msgs).To(ContainElement(
+			"<14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [1] - [gauge@47450 name=\"cpu\" value=\"0.23\" unit=\"percentage\"] \n",
+		))
+		Expect(egressCounter.Value()).To(BeNumerically("==", 5))
+	})
+
+	It("truncates messages larger than the RFC 5426 limit", func() {
+		env := buildLogEnvelope("APP", "2", strings.Repeat("a", 4096), loggregator_v2.Log_OUT)
+		Expect(writer.Write(env)).To(Succeed())
+
+		msg := readDatagram()
+		Expect(msg).To(HaveLen(2048))
+		Expect(msg).To(HavePrefix("<14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [APP/2]"))
+	})
+
+	It("uses the maximum message size of the binding as limit", func() {
+		binding.MaxMessageSize = 8192
+		writer = syslog.NewUDPWriter(
+			binding,
+			netConf,
+			egressCounter,
+			droppedMetric,
+			syslog.NewConverter(),
+			testhelper.NewSpyLogClient(),
+		)
+		env := buildLogEnvelope("APP", "2", strings.Repeat("a", 4096), loggregator_v2.Log_OUT)
+		Expect(writer.Write(env)).To(Succeed())
+
+		Expect(readDatagram()).To(HaveSuffix(strings.Repeat("a", 4096) + "\n"))
+	})
+
+	It("splits RFC 5424 messages at the RFC 5426 limit when created by the writer factory", func() {
+		f := syslog.NewWriterFactory(nil, nil, netConf, metricsHelpers.NewMetricsRegistry())
+		writer, err := f.NewWriter(binding, testhelper.NewSpyLogClient())
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(writer.Close)
+
+		env := buildLogEnvelope("APP", "2", strings.Repeat("a", 4096), loggregator_v2.Log_OUT)
+		Expect(writer.Write(env)).To(Succeed())
+
+		var payload string
+		for range 3 {
+			msg := readDatagram()
+			Expect(len(msg)).To(BeNumerically("<=", 2048))
+			Expect(msg).To(HavePrefix("<14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [APP/2]"))
+			payload += strings.TrimRight(msg[strings.LastIndex(msg, "] ")+2:], "\n")
+		}
+		Expect(payload).To(Equal(strings.Repeat("a", 4096)))
+	})
+
+	It("does not split multi-byte characters when truncating", func() {
+		prefix := `<14>1 1970-01-01T00:00:00.012345+00:00 test-hostname test-app-id [APP/2] - [tags@47450 source_type="APP"] `
+		payload := strings.Repeat("a", 2047-len(prefix)) + "é"
+		env := buildLogEnvelope("APP", "2", payload, loggregator_v2.Log_OUT)
+		Expect(writer.Write(env)).To(Succeed())
+
+		Expect(readDatagram()).To(HaveLen(2047))
+	})
+
+	It("returns an error when the drain address cannot be resolved", func() {
+		binding.URL, _ = url.Parse("syslog-udp://localhost-garbage:9999")
+		writer = syslog.NewUDPWriter(
+			binding,
+			netConf,
+			egressCounter,
+			droppedMetric,
+			syslog.NewConverter(),
+			testhelper.NewSpyLogClient(),
+		)
+
+		env := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
+		Expect(writer.Write(env)).ToNot(Succeed())
+	})
+
+	It("counts messages as dropped when the datagram cannot be sent", func() {
+		env := buildLogEnvelope("APP", "2", "just a test", loggregator_v2.Log_OUT)
+		Expect(writer.Write(env)).To(Succeed())
+		readDatagram()
+		listener.Close()
+
+		// The first write after the listener is gone triggers an ICMP port
+		// unreachable which is reported on a subsequent write.
+		Eventually(func() float64 {
+			Expect(writer.Write(env)).To(Succeed())
+			return droppedMetric.Value()
+		}).Should(BeNumerically(">=", 1))
+	})
+})
@@ -3,7 +3,10 @@ package syslog
 // URLBinding associates a particular application with a syslog URL. The
 import (
 	"context"
+	"net/http"
 	"net/url"
+	"sort"
+	"strings"
 )
 
 // application is identified by AppID and Hostname. The syslog URL is
@@ -14,10 +17,37 @@ type URLBinding struct {
 	Hostname     string
 	OmitMetadata bool
 	InternalTls  bool
-	URL          *url.URL
-	PrivateKey   []byte //nolint:gosec
-	Certificate  []byte
-	CA           []byte
+	Framing      Framing
+	Format       Format
+	Compression  Compression
+	Connections  int
+	DrainData    DrainData
+	// MaxMessageSize is the maximum size of RFC 5424 log messages and the
+	// datagram size of syslog-udp drains. 0 disables the limit, except for
+	// syslog-udp drains which then use the RFC 5426 limit of 2048 bytes.
+	MaxMessageSize    int
+	OversizedMessages OversizedMessages
+	// CombineGauges renders all values of a gauge envelope as a single
+	// RFC 5424 message.
+	CombineGauges bool
+	// HostnameTemplate and AppNameTemplate override the HOSTNAME and
+	// APP-NAME of messages with values rendered from envelope tags.
+	HostnameTemplate string
+	AppNameTemplate  string
+	// SampleRate is the fraction of envelopes that are written to the drain.
+	// 0 disables sampling.
+	SampleRate float64
+	URL        *url.URL
+	// Headers are added to every request sent to HTTPS drains.
+	Headers []Header
+	// CircuitBreaker is shared by all retries for the binding. It may be nil.
+	CircuitBreaker *CircuitBreaker
+	PrivateKey     []byte //nolint:gosec
+	Certificate    []byte
+	CA             []byte
+	// Username and Password authenticate with drains that support SASL.
+	Username string
+	Password string //nolint:gosec
 }
 
 // Scheme is a convenience wrapper around the *url.URL Scheme field
@@ -32,16 +62,95 @@ func buildBinding(c context.Context, b Binding) (*URLBinding, error) {
 	}
 
 	u := &URLBinding{
-		AppID:        b.AppId,
-		OmitMetadata: b.OmitMetadata,
-		InternalTls:  b.InternalTls,
-		URL:          url,
-		Hostname:     b.Hostname,
-		Context:      c,
-		PrivateKey:   []byte(b.Drain.Credentials.Key),
-		Certificate:  []byte(b.Drain.Credentials.Cert),
-		CA:           []byte(b.Drain.Credentials.CA),
+		AppID:             b.AppId,
+		OmitMetadata:      b.OmitMetadata,
+		InternalTls:       b.InternalTls,
+		Framing:           b.Framing,
+		Format:            b.Format,
+		Compression:       b.Compression,
+		Connections:       b.Connections,
+		DrainData:         b.DrainData,
+		MaxMessageSize:    b.MaxMessageSize,
+		OversizedMessages: b.OversizedMessages,
+		CombineGauges:     b.CombineGauges,
+		HostnameTemplate:  b.HostnameTemplate,
+		AppNameTemplate:   b.AppNameTemplate,
+		SampleRate:        b.SampleRate,
+		Headers:           extractHeaders(url),
+		URL:               url,
+		Hostname:          b.Hostname,
+		Context:           c,
+		PrivateKey:        []byte(b.Drain.Credentials.Key),
+		Certificate:       []byte(b.Drain.Credentials.Cert),
+		CA:                []byte(b.Drain.Credentials.CA),
+		Username:          b.Drain.Credentials.Username,
+		Password:          b.Drain.Credentials.Password,
 	}
 
 	return u, nil
 }
+
+const (
+	headerParamPrefix = "header-"
+	bearerTokenParam  = "bearer-token"
+)
+
+// Header is an HTTP header that is sent to a drain.
+type Header struct {
+	Name  string
+	Value string
+}
+
+// reservedHeaders are set by the writers and can not be overridden by
+// bindings.
+var reservedHeaders = map[string]bool{
+	"Connection":        true,
+	"Content-Encoding":  true,
+	"Content-Length":    true,
+	"Content-Type":      true,
+	"Host":              true,
+	"Transfer-Encoding": true,
+}
+
+// extractHeaders removes the header-<name> and bearer-token parameters from
+// the query of u and returns the headers they specify. The parameters are
+// removed so that the values are never sent as part of the URL.
+func extractHeaders(u *url.URL) []Header {
+	q := u.Query()
+
+	var headers []Header
+	removed := false
+	for param, values := range q {
+		var name string
+		switch {
+		case param == bearerTokenParam:
+			name = "Authorization"
+		case strings.HasPrefix(param, headerParamPrefix):
+			name = http.CanonicalHeaderKey(strings.TrimPrefix(param, headerParamPrefix))
+		default:
+			continue
+		}
+		q.Del(param)
+		removed = true
+
+		if name == "" || reservedHeaders[name] || len(values) == 0 {
+			continue
+		}
+		value := values[len(values)-1]
+		if value == "" {
+			continue
+		}
+		if param == bearerTokenParam {
+			value = "Bearer " + value
+		}
+		headers = append(headers, Header{Name: name, Value: value})
+	}
+	if removed {
+		u.RawQuery = q.Encode()
+	}
+
+	sort.Slice(headers, func(i, j int) bool {
+		return headers[i].Name < headers[j].Name
+	})
+	return headers
+}
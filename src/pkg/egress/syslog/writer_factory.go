@@ -3,7 +3,10 @@ package syslog
 import (
 	"crypto/tls"
 	"fmt"
+	"log"
 	"net/url"
+	"strconv"
+	"time"
 
 	metrics "code.cloudfoundry.org/go-metric-registry"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress"
@@ -12,6 +15,7 @@ import (
 
 type metricClient interface {
 	NewCounter(name, helpText string, o ...metrics.MetricOption) metrics.Counter
+	NewGauge(name, helpText string, o ...metrics.MetricOption) metrics.Gauge
 }
 
 type WriterFactoryError struct {
@@ -42,15 +46,42 @@ type WriterFactory struct {
 	externalTlsConfig *tls.Config
 	netConf           NetworkTimeoutConfig
 	m                 metricClient
+	spool             *Spool
+
+	circuitBreakerThreshold     int
+	circuitBreakerProbeInterval time.Duration
+}
+
+type WriterFactoryOption func(*WriterFactory)
+
+// WithDrainSpool spools batches that https-batch, loki, elasticsearch,
+// opensearch and splunk-hec writers fail to send.
+func WithDrainSpool(s *Spool) WriterFactoryOption {
+	return func(f *WriterFactory) {
+		f.spool = s
+	}
 }
 
-func NewWriterFactory(internalTlsConfig *tls.Config, externalTlsConfig *tls.Config, netConf NetworkTimeoutConfig, m metricClient) WriterFactory {
-	return WriterFactory{
+// WithCircuitBreaker stops writes to drains after threshold consecutive
+// failures and probes them again every probeInterval.
+func WithCircuitBreaker(threshold int, probeInterval time.Duration) WriterFactoryOption {
+	return func(f *WriterFactory) {
+		f.circuitBreakerThreshold = threshold
+		f.circuitBreakerProbeInterval = probeInterval
+	}
+}
+
+func NewWriterFactory(internalTlsConfig *tls.Config, externalTlsConfig *tls.Config, netConf NetworkTimeoutConfig, m metricClient, opts ...WriterFactoryOption) WriterFactory {
+	f := WriterFactory{
 		internalTlsConfig: internalTlsConfig,
 		externalTlsConfig: externalTlsConfig,
 		netConf:           netConf,
 		m:                 m,
 	}
+	for _, o := range opts {
+		o(&f)
+	}
+	return f
 }
 
 func (f WriterFactory) NewWriter(ub *URLBinding, appLogClient v2.LogClient) (egress.WriteCloser, error) {
@@ -92,11 +123,72 @@ func (f WriterFactory) NewWriter(ub *URLBinding, appLogClient v2.LogClient) (egr
 		}),
 	)
 
+	droppedMetric := f.m.NewCounter(
+		"messages_dropped_per_drain",
+		"Total number of dropped messages.",
+		metrics.WithMetricLabels(map[string]string{
+			"direction":   "egress",
+			"drain_scope": drainScope,
+			"drain_url":   anonymousURL.String(),
+		}),
+	)
+
+	if f.circuitBreakerThreshold > 0 {
+		ub.CircuitBreaker = NewCircuitBreaker(
+			f.circuitBreakerThreshold,
+			f.circuitBreakerProbeInterval,
+			droppedMetric,
+			f.circuitStateLogger(anonymousURL.String(), ub.AppID, appLogClient),
+		)
+	}
+
 	var o []ConverterOption
 	if ub.OmitMetadata {
 		o = append(o, WithoutSyslogMetadata())
 	}
-	converter := NewConverter(o...)
+	if ub.HostnameTemplate != "" {
+		o = append(o, WithHostnameTemplate(ub.HostnameTemplate))
+	}
+	if ub.AppNameTemplate != "" {
+		o = append(o, WithAppNameTemplate(ub.AppNameTemplate))
+	}
+	if ub.SampleRate > 0 {
+		o = append(o, WithSampleRate(ub.SampleRate))
+	}
+	if ub.CombineGauges {
+		o = append(o, WithCombinedGauges())
+	}
+	maxMessageSize := ub.MaxMessageSize
+	if ub.URL.Scheme == "syslog-udp" && ub.Format == FormatRFC5424 {
+		// Messages to UDP drains are split to fit into a datagram even if the
+		// drain sets no maximum message size.
+		maxMessageSize = udpMessageSize(ub.MaxMessageSize)
+	}
+	if maxMessageSize > 0 {
+		o = append(o, WithMaxMessageSize(
+			maxMessageSize,
+			ub.OversizedMessages,
+			f.m.NewCounter(
+				"split_messages",
+				"Total number of log messages split because they exceeded the maximum message size.",
+				metrics.WithMetricLabels(map[string]string{
+					"direction":   "egress",
+					"drain_scope": drainScope,
+					"drain_url":   anonymousURL.String(),
+				}),
+			),
+			f.m.NewCounter(
+				"truncated_messages",
+				"Total number of log messages truncated because they exceeded the maximum message size.",
+				metrics.WithMetricLabels(map[string]string{
+					"direction":   "egress",
+					"drain_scope": drainScope,
+					"drain_url":   anonymousURL.String(),
+				}),
+			),
+		))
+	}
+	converter := NewMessageConverter(ub.Format, o...)
 
 	var w egress.WriteCloser
 	switch ub.URL.Scheme {
@@ -115,24 +207,140 @@ func (f WriterFactory) NewWriter(ub *URLBinding, appLogClient v2.LogClient) (egr
 			tlsCfg,
 			egressMetric,
 			converter,
+			f.batchWriterOptions(ub, drainScope, anonymousURL.String())...,
 		)
-	case "syslog":
-		w = NewTCPWriter(
+	case "loki":
+		w = NewLokiWriter(
 			ub,
 			f.netConf,
+			tlsCfg,
 			egressMetric,
-			converter,
-			appLogClient,
+			o,
+			f.batchWriterOptions(ub, drainScope, anonymousURL.String())...,
+		)
+	case "elasticsearch", "opensearch":
+		w = NewElasticsearchWriter(
+			ub,
+			f.netConf,
+			tlsCfg,
+			egressMetric,
+			droppedMetric,
+			o,
+			f.batchWriterOptions(ub, drainScope, anonymousURL.String())...,
 		)
-	case "syslog-tls":
-		w = NewTLSWriter(
+	case "splunk-hec":
+		w = NewSplunkHECWriter(
 			ub,
 			f.netConf,
 			tlsCfg,
 			egressMetric,
+			o,
+			f.batchWriterOptions(ub, drainScope, anonymousURL.String())...,
+		)
+	case "kafka", "kafka-tls":
+		if ub.AppID != "" {
+			return nil, NewWriterFactoryErrorf(ub.URL, "kafka drains are only supported as aggregate drains")
+		}
+		var kafkaTLS *tls.Config
+		if ub.URL.Scheme == "kafka-tls" {
+			kafkaTLS = tlsCfg
+		}
+		// The Kafka producer retries failed batches on its own.
+		kw, err := NewKafkaWriter(
+			ub,
+			f.netConf,
+			kafkaTLS,
+			egressMetric,
+			droppedMetric,
+			f.partitionMetric(drainScope, anonymousURL.String()),
+			converter,
+		)
+		if err != nil {
+			return nil, NewWriterFactoryErrorf(ub.URL, "%s", err)
+		}
+		return kw, nil
+	case "otlp-https":
+		// The OTLP writer retries failed exports on its own.
+		return NewOTLPWriter(ub, tlsCfg, egressMetric, maxRetries), nil
+	case "syslog", "syslog-tls", "gelf", "gelf-tls", "relp", "relp-tls":
+		connBinding, connConverter := ub, converter
+		if ub.URL.Scheme == "gelf" || ub.URL.Scheme == "gelf-tls" {
+			// GELF messages are delimited by null bytes on TCP.
+			gb := *ub
+			gb.Framing = NonTransparentNUL
+			connBinding, connConverter = &gb, NewGELFConverter(o...)
+		}
+
+		newConn := func() egress.WriteCloser {
+			switch ub.URL.Scheme {
+			case "syslog-tls", "gelf-tls":
+				return NewTLSWriter(
+					connBinding,
+					f.netConf,
+					tlsCfg,
+					egressMetric,
+					connConverter,
+					appLogClient,
+				)
+			case "relp", "relp-tls":
+				// RELP counts messages as egressed when the drain
+				// acknowledges them.
+				var relpTLS *tls.Config
+				if ub.URL.Scheme == "relp-tls" {
+					relpTLS = tlsCfg
+				}
+				return NewRELPWriter(
+					connBinding,
+					f.netConf,
+					relpTLS,
+					egressMetric,
+					droppedMetric,
+					connConverter,
+					appLogClient,
+				)
+			}
+			return NewTCPWriter(
+				connBinding,
+				f.netConf,
+				egressMetric,
+				connConverter,
+				appLogClient,
+			)
+		}
+
+		connections := max(ub.Connections, 1)
+		f.m.NewGauge(
+			"drain_connections",
+			"Number of connections to the drain.",
+			metrics.WithMetricLabels(map[string]string{
+				"direction":   "egress",
+				"drain_scope": drainScope,
+				"drain_url":   anonymousURL.String(),
+			}),
+		).Set(float64(connections))
+
+		if connections > 1 {
+			return f.newParallelWriter(ub, connections, drainScope, anonymousURL.String(), newConn)
+		}
+		w = newConn()
+	case "syslog-udp":
+		w = NewUDPWriter(
+			ub,
+			f.netConf,
+			egressMetric,
+			droppedMetric,
 			converter,
 			appLogClient,
 		)
+	case "gelf-udp":
+		w = NewGELFUDPWriter(
+			ub,
+			f.netConf,
+			egressMetric,
+			droppedMetric,
+			appLogClient,
+			o...,
+		)
 	}
 
 	if w == nil {
@@ -153,3 +361,133 @@ func (f WriterFactory) NewWriter(ub *URLBinding, appLogClient v2.LogClient) (egr
 		w,
 	)
 }
+
+// batchWriterOptions returns the options for batching writers that are
+// configured by the binding or the factory.
+func (f WriterFactory) batchWriterOptions(ub *URLBinding, drainScope, drainURL string) []Option {
+	var opts []Option
+	// Receivers of the other batching writers do not accept every
+	// compression, Elasticsearch for example rejects zstd.
+	if ub.Compression != NoCompression && ub.URL.Scheme == "https-batch" {
+		opts = append(opts, WithCompression(
+			ub.Compression,
+			f.m.NewCounter(
+				"uncompressed_bytes",
+				"Total number of bytes in batches before compression.",
+				metrics.WithMetricLabels(map[string]string{
+					"direction":   "egress",
+					"drain_scope": drainScope,
+					"drain_url":   drainURL,
+				}),
+			),
+			f.m.NewCounter(
+				"compressed_bytes",
+				"Total number of bytes in batches after compression.",
+				metrics.WithMetricLabels(map[string]string{
+					"direction":   "egress",
+					"drain_scope": drainScope,
+					"drain_url":   drainURL,
+				}),
+			),
+		))
+	}
+	if f.spool != nil {
+		opts = append(opts, WithSpool(
+			f.spool,
+			spoolKey(ub),
+			f.m.NewGauge(
+				"spool_batches",
+				"Number of batches waiting in the spool.",
+				metrics.WithMetricLabels(map[string]string{
+					"direction":   "egress",
+					"drain_scope": drainScope,
+					"drain_url":   drainURL,
+				}),
+			),
+			f.m.NewGauge(
+				"spool_bytes",
+				"Number of bytes waiting in the spool.",
+				metrics.WithMetricLabels(map[string]string{
+					"direction":   "egress",
+					"drain_scope": drainScope,
+					"drain_url":   drainURL,
+				}),
+			),
+		))
+	}
+	return opts
+}
+
+// newParallelWriter opens several connections to a drain. Every connection
+// retries failed writes on its own.
+func (f WriterFactory) newParallelWriter(
+	ub *URLBinding,
+	connections int,
+	drainScope string,
+	drainURL string,
+	newConn func() egress.WriteCloser,
+) (egress.WriteCloser, error) {
+	writers := make([]egress.WriteCloser, connections)
+	for i := range writers {
+		conn := &countingWriter{
+			WriteCloser: newConn(),
+			egressMetric: f.m.NewCounter(
+				"connection_egress",
+				"Total number of envelopes written per connection.",
+				metrics.WithMetricLabels(map[string]string{
+					"direction":   "egress",
+					"drain_scope": drainScope,
+					"drain_url":   drainURL,
+					"connection":  strconv.Itoa(i),
+				}),
+			),
+		}
+		w, err := NewRetryWriter(
+			ub,
+			ExponentialDuration,
+			maxRetries,
+			conn,
+		)
+		if err != nil {
+			return nil, err
+		}
+		writers[i] = w
+	}
+
+	return NewParallelWriter(writers), nil
+}
+
+// partitionMetric returns the counters of messages delivered to the
+// partitions of a Kafka drain.
+func (f WriterFactory) partitionMetric(drainScope, drainURL string) func(int32) metrics.Counter {
+	return func(partition int32) metrics.Counter {
+		return f.m.NewCounter(
+			"partition_egress",
+			"Total number of envelopes delivered per Kafka partition.",
+			metrics.WithMetricLabels(map[string]string{
+				"direction":   "egress",
+				"drain_scope": drainScope,
+				"drain_url":   drainURL,
+				"partition":   strconv.Itoa(int(partition)),
+			}),
+		)
+	}
+}
+
+// circuitStateLogger reports when a drain starts failing and when it
+// recovers. Probes are not reported.
+func (f WriterFactory) circuitStateLogger(drainURL, appID string, appLogClient v2.LogClient) func(from, to CircuitState) {
+	return func(from, to CircuitState) {
+		var msg string
+		switch {
+		case from == CircuitClosed && to == CircuitOpen:
+			msg = fmt.Sprintf("Syslog drain %s keeps failing, dropping messages and probing it every %s", drainURL, f.circuitBreakerProbeInterval)
+		case to == CircuitClosed:
+			msg = fmt.Sprintf("Syslog drain %s recovered, resuming delivery", drainURL)
+		default:
+			return
+		}
+		v2.EmitAppLog(appLogClient, msg, appID)
+		log.Printf("%s for app %s", msg, appID)
+	}
+}
@@ -42,9 +42,11 @@ func (a *AggregateDrainFetcher) FetchBindings() ([]syslog.Binding, error) {
 			}
 			if len(i.Credentials) > 0 {
 				b.Drain.Credentials = syslog.Credentials{
-					CA:   i.Credentials[0].CA,
-					Cert: i.Credentials[0].Cert,
-					Key:  i.Credentials[0].Key,
+					CA:       i.Credentials[0].CA,
+					Cert:     i.Credentials[0].Cert,
+					Key:      i.Credentials[0].Key,
+					Username: i.Credentials[0].Username,
+					Password: i.Credentials[0].Password,
 				}
 			}
 			syslogBindings = append(syslogBindings, b)
@@ -1,22 +1,101 @@
 package bindings
 
 import (
+	"fmt"
+	"log"
 	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/binding"
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/egress/syslog"
+	v2 "code.cloudfoundry.org/loggregator-agent-release/src/pkg/ingress/v2"
 )
 
 type DrainParamParser struct {
 	fetcher              binding.Fetcher
 	defaultDrainMetadata bool
+	defaultCompression   syslog.Compression
+	defaultRateLimit     int
+	defaultBurst         int
+	hostnameTemplate     string
+	appNameTemplate      string
+	defaultRedact        string
+	redactionRules       []syslog.RedactionRule
+	logClient            v2.LogClient
+	logger               *log.Logger
 }
 
-func NewDrainParamParser(f binding.Fetcher, defaultDrainMetadata bool) *DrainParamParser {
-	return &DrainParamParser{
+// DrainParamParserOption allows operator defaults for drain parameters to be
+// configured.
+type DrainParamParserOption func(*DrainParamParser)
+
+// WithDefaultCompression sets the compression used for https-batch drains
+// that do not specify one in their URL.
+func WithDefaultCompression(c syslog.Compression) DrainParamParserOption {
+	return func(d *DrainParamParser) {
+		d.defaultCompression = c
+	}
+}
+
+// WithDefaultRateLimit sets the rate limit in envelopes per second and the
+// burst used for drains that do not specify them in their URL.
+func WithDefaultRateLimit(rate, burst int) DrainParamParserOption {
+	return func(d *DrainParamParser) {
+		d.defaultRateLimit = rate
+		d.defaultBurst = burst
+	}
+}
+
+// WithDefaultHeaderTemplates sets the hostname and app name templates used
+// for drains that do not specify them in their URL.
+func WithDefaultHeaderTemplates(hostname, appName string) DrainParamParserOption {
+	return func(d *DrainParamParser) {
+		d.hostnameTemplate = hostname
+		d.appNameTemplate = appName
+	}
+}
+
+// WithDefaultRedaction sets the comma separated names of the redaction rules
+// applied to drains that do not specify them in their URL.
+func WithDefaultRedaction(names string) DrainParamParserOption {
+	return func(d *DrainParamParser) {
+		d.defaultRedact = names
+	}
+}
+
+// WithRedactionRules makes redaction rules available to drains in addition
+// to the built-in ones. Drains that select unknown rules are ignored.
+func WithRedactionRules(rules ...syslog.RedactionRule) DrainParamParserOption {
+	return func(d *DrainParamParser) {
+		d.redactionRules = append(d.redactionRules, rules...)
+	}
+}
+
+// WithWarnings sets where problems with the parameters of a drain are
+// reported. They are written to the logger and, for app drains, to the log
+// stream of the app.
+func WithWarnings(logClient v2.LogClient, logger *log.Logger) DrainParamParserOption {
+	return func(d *DrainParamParser) {
+		d.logClient = logClient
+		d.logger = logger
+	}
+}
+
+func NewDrainParamParser(f binding.Fetcher, defaultDrainMetadata bool, opts ...DrainParamParserOption) *DrainParamParser {
+	d := &DrainParamParser{
 		fetcher:              f,
 		defaultDrainMetadata: defaultDrainMetadata,
+		redactionRules:       syslog.BuiltinRedactionRules(),
+		logger:               log.Default(),
+	}
+	for _, o := range opts {
+		o(d)
 	}
+	return d
 }
 
 func (d *DrainParamParser) FetchBindings() ([]syslog.Binding, error) {
@@ -35,6 +114,49 @@ func (d *DrainParamParser) FetchBindings() ([]syslog.Binding, error) {
 		b.OmitMetadata = getOmitMetadata(urlParsed, d.defaultDrainMetadata)
 		b.InternalTls = getInternalTLS(urlParsed)
 		b.DrainData = getBindingType(urlParsed)
+		b.Framing = getFraming(urlParsed)
+		b.Format = getFormat(urlParsed)
+		b.Compression = getCompression(urlParsed, syslog.NoCompression)
+		if urlParsed.Scheme == "https-batch" {
+			b.Compression = getCompression(urlParsed, d.defaultCompression)
+		}
+		b.RateLimit = getNonNegativeInt(urlParsed, "rate-limit", d.defaultRateLimit)
+		b.Burst = getNonNegativeInt(urlParsed, "burst", d.defaultBurst)
+		b.Connections = min(getNonNegativeInt(urlParsed, "connections", 1), syslog.MaxConnectionsPerDrain)
+		b.MaxMessageSize = getNonNegativeInt(urlParsed, "max-message-size", 0)
+		b.OversizedMessages = getOversizedMessages(urlParsed)
+		b.CombineGauges = urlParsed.Query().Get("combine-gauges") == "true"
+		b.HostnameTemplate = getString(urlParsed, "hostname-template", d.hostnameTemplate)
+		b.AppNameTemplate = getString(urlParsed, "appname-template", d.appNameTemplate)
+		b.Redact = getString(urlParsed, "redact", d.defaultRedact)
+		b.SampleRate = getSampleRate(urlParsed)
+		b.IncludeSourceTypes = urlParsed.Query().Get("include-source-types")
+		b.ExcludeSourceTypes = urlParsed.Query().Get("exclude-source-types")
+		b.LogType = getLogType(urlParsed)
+		b.MetricsInclude = urlParsed.Query().Get("metrics-include")
+		b.MetricsExclude = urlParsed.Query().Get("metrics-exclude")
+		b.CoalesceWindow = getNonNegativeDuration(urlParsed, "coalesce-window")
+		b.CoalescePattern = urlParsed.Query().Get("coalesce-pattern")
+
+		anonymousURL := *urlParsed
+		anonymousURL.User = nil
+		anonymousURL.RawQuery = ""
+
+		d.ignoreUnsupportedParams(urlParsed.Scheme, &b, anonymousURL.String())
+
+		if b.Redact != "" {
+			if _, err := syslog.SelectRedactionRules(d.redactionRules, b.Redact); err != nil {
+				d.printWarning(b.AppId, "Ignoring syslog drain %s: %s", anonymousURL.String(), err)
+				continue
+			}
+		}
+
+		if b.CoalescePattern != "" {
+			if _, err := regexp.Compile(b.CoalescePattern); err != nil {
+				d.printWarning(b.AppId, "Ignoring syslog drain %s: invalid coalesce-pattern: %s", anonymousURL.String(), err)
+				continue
+			}
+		}
 
 		processed = append(processed, b)
 	}
@@ -42,6 +164,48 @@ func (d *DrainParamParser) FetchBindings() ([]syslog.Binding, error) {
 	return processed, nil
 }
 
+// printWarning reports a problem with a drain to the operator and to the app
+// of the drain.
+func (d *DrainParamParser) printWarning(appID, format string, v ...any) {
+	msg := fmt.Sprintf(format, v...)
+	v2.EmitAppLog(d.logClient, msg, appID)
+	d.logger.Print(msg)
+}
+
+// syslogSchemes are the schemes whose messages are serialized in the format
+// selected by the format parameter.
+var syslogSchemes = []string{"syslog", "syslog-tls", "syslog-udp", "relp", "relp-tls", "https", "https-batch", "kafka", "kafka-tls"}
+
+// ignoreUnsupportedParams clears the drain parameters that the scheme or the
+// message format of the drain cannot apply and warns the app of the drain
+// about them. Only https-batch requests are compressed, as not every receiver
+// of the other HTTP schemes accepts every compression. Splitting and
+// truncating oversized messages relies on RFC 5424 structured data. Combined
+// gauges and the sample rate are only rendered by the RFC 5424 and JSON
+// formats.
+func (d *DrainParamParser) ignoreUnsupportedParams(scheme string, b *syslog.Binding, anonymousURL string) {
+	formatted := slices.Contains(syslogSchemes, scheme)
+	rfc5424 := formatted && b.Format == syslog.FormatRFC5424
+	rfc5424OrJSON := rfc5424 || formatted && b.Format == syslog.FormatJSON
+
+	if b.Compression != syslog.NoCompression && scheme != "https-batch" {
+		d.printWarning(b.AppId, "Ignoring compression of syslog drain %s, it is not supported by its scheme", anonymousURL)
+		b.Compression = syslog.NoCompression
+	}
+	if b.MaxMessageSize > 0 && !rfc5424 {
+		d.printWarning(b.AppId, "Ignoring max-message-size of syslog drain %s, it is not supported by its format", anonymousURL)
+		b.MaxMessageSize = 0
+	}
+	if b.CombineGauges && !rfc5424OrJSON {
+		d.printWarning(b.AppId, "Ignoring combine-gauges of syslog drain %s, it is not supported by its format", anonymousURL)
+		b.CombineGauges = false
+	}
+	if b.SampleRate > 0 && !rfc5424OrJSON {
+		d.printWarning(b.AppId, "Ignoring sample-rate of syslog drain %s, it is not supported by its format", anonymousURL)
+		b.SampleRate = 0
+	}
+}
+
 func getInternalTLS(url *url.URL) bool {
 	return url.Query().Get("ssl-strict-internal") == "true"
 }
@@ -84,6 +248,97 @@ func getBindingType(u *url.URL) syslog.DrainData {
 	return drainData
 }
 
+func getFraming(u *url.URL) syslog.Framing {
+	switch u.Query().Get("framing") {
+	case "lf":
+		return syslog.NonTransparentLF
+	case "nul":
+		return syslog.NonTransparentNUL
+	default:
+		return syslog.OctetCounting
+	}
+}
+
+func getFormat(u *url.URL) syslog.Format {
+	switch u.Query().Get("format") {
+	case "rfc3164":
+		return syslog.FormatRFC3164
+	case "json":
+		return syslog.FormatJSON
+	default:
+		return syslog.FormatRFC5424
+	}
+}
+
+func getLogType(u *url.URL) syslog.LogType {
+	switch strings.ToLower(u.Query().Get("log-type")) {
+	case "out":
+		return syslog.OutLogs
+	case "err":
+		return syslog.ErrLogs
+	default:
+		return syslog.AllLogTypes
+	}
+}
+
+func getOversizedMessages(u *url.URL) syslog.OversizedMessages {
+	if u.Query().Get("oversized-messages") == "truncate" {
+		return syslog.TruncateOversized
+	}
+	return syslog.SplitOversized
+}
+
+// getSampleRate returns the sample rate of the drain or 0 if the drain is not
+// sampled. Rates of 1 or more and invalid rates disable sampling.
+func getSampleRate(u *url.URL) float64 {
+	r, err := strconv.ParseFloat(u.Query().Get("sample-rate"), 64)
+	if err != nil || !(r > 0 && r < 1) {
+		return 0
+	}
+	return r
+}
+
+func getCompression(u *url.URL, defaultCompression syslog.Compression) syslog.Compression {
+	q := u.Query().Get("compression")
+	if q == "" {
+		return defaultCompression
+	}
+
+	c, err := syslog.ParseCompression(q)
+	if err != nil {
+		return defaultCompression
+	}
+	return c
+}
+
+func getString(u *url.URL, param string, defaultValue string) string {
+	if q := u.Query().Get(param); q != "" {
+		return q
+	}
+	return defaultValue
+}
+
+func getNonNegativeInt(u *url.URL, param string, defaultValue int) int {
+	q := u.Query().Get(param)
+	if q == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.Atoi(q)
+	if err != nil || i < 0 {
+		return defaultValue
+	}
+	return i
+}
+
+func getNonNegativeDuration(u *url.URL, param string) time.Duration {
+	d, err := time.ParseDuration(u.Query().Get(param))
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
+
 func getRemoveMetadataQuery(u *url.URL) string {
 	q := u.Query().Get("disable-metadata")
 	if q == "" {
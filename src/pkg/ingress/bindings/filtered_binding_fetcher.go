@@ -10,7 +10,7 @@ import (
 	"code.cloudfoundry.org/loggregator-agent-release/src/pkg/simplecache"
 )
 
-var allowedSchemes = []string{"syslog", "syslog-tls", "https", "https-batch"}
+var allowedSchemes = []string{"syslog", "syslog-tls", "syslog-udp", "https", "https-batch", "splunk-hec", "loki", "elasticsearch", "opensearch", "otlp-https", "gelf", "gelf-tls", "gelf-udp", "relp", "relp-tls"}
 
 type FilteredBindingFetcher struct {
 	ipChecker        binding.IPChecker
@@ -140,6 +140,7 @@ var _ = Describe("FilteredBindingFetcher", func() {
 				{AppId: "app-id", Hostname: "known", Drain: syslog.Drain{Url: "syslog://10.10.10.10"}},
 				{AppId: "app-id", Hostname: "known", Drain: syslog.Drain{Url: "syslog-tls://10.10.10.10"}},
 				{AppId: "app-id", Hostname: "known", Drain: syslog.Drain{Url: "https://10.10.10.10"}},
+				{AppId: "app-id", Hostname: "known", Drain: syslog.Drain{Url: "syslog-udp://10.10.10.10"}},
 				{AppId: "app-id", Hostname: "unknown", Drain: syslog.Drain{Url: "bad-scheme://10.10.10.10"}},
 				{AppId: "app-id", Hostname: "unknown", Drain: syslog.Drain{Url: "bad-scheme:///path"}},
 				{AppId: "app-id", Hostname: "unknown", Drain: syslog.Drain{Url: "blah://10.10.10.10"}},
@@ -164,7 +165,7 @@ var _ = Describe("FilteredBindingFetcher", func() {
 			actual, err := filter.FetchBindings()
 
 			Expect(err).ToNot(HaveOccurred())
-			Expect(actual).To(Equal(input[:3]))
+			Expect(actual).To(Equal(input[:4]))
 			Expect(logBuffer.String()).Should(MatchRegexp("Invalid drains detected in the Syslog Agent. This should not happen. Check your Syslog Binding Cache and its API"))
 		})
 		Context("when configured not to warn", func() {
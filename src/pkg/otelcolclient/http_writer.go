@@ -0,0 +1,264 @@
+package otelcolclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	metrics "code.cloudfoundry.org/go-metric-registry"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	protobufContentType = "application/x-protobuf"
+	// flushTimeout bounds the export of batches that are written after the
+	// context of an HTTPWriter is done.
+	flushTimeout = 10 * time.Second
+)
+
+// HTTPWriterConfig holds tunable parameters for the HTTPWriter.
+type HTTPWriterConfig struct {
+	// MaxRetries is the maximum number of retry attempts before a batch is dropped.
+	MaxRetries int
+	// Headers are added to every request.
+	Headers http.Header
+	// EgressMetric counts the signals accepted by the receiver.
+	EgressMetric metrics.Counter
+	// CircuitBreaker drops batches instead of exporting them while the
+	// receiver keeps failing. It is optional.
+	CircuitBreaker CircuitBreaker
+}
+
+// CircuitBreaker decides whether an export is attempted and is told about
+// the result of every attempt. Allow counts the signals it refuses as
+// dropped.
+type CircuitBreaker interface {
+	Allow(count float64) bool
+	Success()
+	Failure()
+}
+
+// HTTPWriter exports batches of OpenTelemetry signals as protobuf to the
+// /v1/logs, /v1/metrics and /v1/traces endpoints of an OTLP/HTTP receiver.
+// Failed exports are retried with exponential backoff while the batch is
+// held, which blocks further writes to the SignalBatcher.
+type HTTPWriter struct {
+	client   *http.Client
+	endpoint *url.URL
+	user     *url.Userinfo
+	headers  http.Header
+
+	ctx    context.Context
+	cancel func()
+
+	l              *log.Logger
+	egressMetric   metrics.Counter
+	circuitBreaker CircuitBreaker
+
+	maxRetries        int
+	initialRetryDelay time.Duration
+	maxRetryDelay     time.Duration
+	flushTimeout      time.Duration
+}
+
+// NewHTTPWriter returns an HTTPWriter that exports to the receiver at
+// endpoint. The signal paths are appended to the path of the endpoint.
+// Userinfo of the endpoint is sent as basic auth. Requests and retries are
+// aborted once ctx is done or the writer is closed. Batches that are written
+// after that, like the ones flushed when a drain is closed, are exported with
+// a context of their own that times out after flushTimeout.
+func NewHTTPWriter(ctx context.Context, endpoint *url.URL, tlsConfig *tls.Config, cfg HTTPWriterConfig, l *log.Logger) *HTTPWriter {
+	u := *endpoint
+	u.User = nil
+	u.Path = strings.TrimSuffix(u.Path, "/")
+
+	ctx, cancel := context.WithCancel(ctx)
+	return &HTTPWriter{
+		client: &http.Client{
+			Timeout: 20 * time.Second,
+			Transport: &http.Transport{
+				Proxy:               http.ProxyFromEnvironment,
+				TLSClientConfig:     tlsConfig,
+				MaxIdleConnsPerHost: 5,
+				IdleConnTimeout:     90 * time.Second,
+			},
+		},
+		endpoint:          &u,
+		user:              endpoint.User,
+		headers:           cfg.Headers,
+		ctx:               ctx,
+		cancel:            cancel,
+		l:                 l,
+		egressMetric:      cfg.EgressMetric,
+		circuitBreaker:    cfg.CircuitBreaker,
+		maxRetries:        cfg.MaxRetries,
+		initialRetryDelay: retryInitialDelay,
+		maxRetryDelay:     retryMaxDelay,
+		flushTimeout:      flushTimeout,
+	}
+}
+
+// WriteLogs exports the batch to /v1/logs.
+func (w *HTTPWriter) WriteLogs(batch []*logspb.ResourceLogs) {
+	w.export("/v1/logs", &collogspb.ExportLogsServiceRequest{ResourceLogs: batch}, len(batch), func(body []byte) error {
+		var r collogspb.ExportLogsServiceResponse
+		if err := proto.Unmarshal(body, &r); err != nil {
+			return nil
+		}
+		return errorOnLogsRejection(&r)
+	})
+}
+
+// WriteMetrics exports the batch to /v1/metrics.
+func (w *HTTPWriter) WriteMetrics(batch []*metricspb.Metric) {
+	req := &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{
+			{
+				ScopeMetrics: []*metricspb.ScopeMetrics{
+					{
+						Metrics: batch,
+					},
+				},
+			},
+		},
+	}
+	w.export("/v1/metrics", req, len(batch), func(body []byte) error {
+		var r colmetricspb.ExportMetricsServiceResponse
+		if err := proto.Unmarshal(body, &r); err != nil {
+			return nil
+		}
+		return errorOnRejection(&r)
+	})
+}
+
+// WriteTrace exports the batch to /v1/traces.
+func (w *HTTPWriter) WriteTrace(batch []*tracepb.ResourceSpans) {
+	w.export("/v1/traces", &coltracepb.ExportTraceServiceRequest{ResourceSpans: batch}, len(batch), func(body []byte) error {
+		var r coltracepb.ExportTraceServiceResponse
+		if err := proto.Unmarshal(body, &r); err != nil {
+			return nil
+		}
+		return errorOnTraceRejection(&r)
+	})
+}
+
+// Close aborts pending retries.
+func (w *HTTPWriter) Close() error {
+	w.cancel()
+	return nil
+}
+
+// errRetryable marks export failures that are worth retrying.
+var errRetryable = errors.New("retryable")
+
+func (w *HTTPWriter) export(path string, req proto.Message, count int, rejection func([]byte) error) {
+	body, err := proto.Marshal(req)
+	if err != nil {
+		w.l.Printf("Dropped %d OTLP signals for %s: %s", count, w.redactedEndpoint(), err)
+		return
+	}
+
+	ctx := w.ctx
+	if ctx.Err() != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), w.flushTimeout)
+		defer cancel()
+	}
+
+	delay := w.initialRetryDelay
+	for attempt := 0; ; attempt++ {
+		if w.circuitBreaker != nil && !w.circuitBreaker.Allow(float64(count)) {
+			w.l.Printf("Dropped %d OTLP signals for %s, circuit breaker is open", count, w.redactedEndpoint())
+			return
+		}
+
+		err = w.post(ctx, path, body, rejection)
+		if err == nil {
+			if w.circuitBreaker != nil {
+				w.circuitBreaker.Success()
+			}
+			w.egressMetric.Add(float64(count))
+			return
+		}
+		if w.circuitBreaker != nil {
+			w.circuitBreaker.Failure()
+		}
+		if !errors.Is(err, errRetryable) || attempt >= w.maxRetries {
+			w.l.Printf("Dropped %d OTLP signals for %s after %d attempts: %s", count, w.redactedEndpoint(), attempt+1, err)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			w.l.Printf("Dropped %d OTLP signals for %s, writer closed: %s", count, w.redactedEndpoint(), err)
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, w.maxRetryDelay)
+	}
+}
+
+// post sends a single export request. Errors of requests that failed because
+// of the network or an overloaded or unavailable receiver wrap errRetryable.
+func (w *HTTPWriter) post(ctx context.Context, path string, body []byte, rejection func([]byte) error) error {
+	u := *w.endpoint
+	u.Path += path
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, values := range w.headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", protobufContentType)
+	if w.user != nil {
+		password, _ := w.user.Password()
+		req.SetBasicAuth(w.user.Username(), password)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		if isContextError(err) {
+			return err
+		}
+		return fmt.Errorf("%w: %s", errRetryable, err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		if err := rejection(respBody); err != nil {
+			w.l.Printf("OTLP receiver %s rejected signals: %s", w.redactedEndpoint(), err)
+		}
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode == http.StatusBadGateway,
+		resp.StatusCode == http.StatusServiceUnavailable,
+		resp.StatusCode == http.StatusGatewayTimeout:
+		return fmt.Errorf("%w: receiver responded with %d status code", errRetryable, resp.StatusCode)
+	default:
+		return fmt.Errorf("receiver responded with %d status code", resp.StatusCode)
+	}
+}
+
+func (w *HTTPWriter) redactedEndpoint() string {
+	u := *w.endpoint
+	u.RawQuery = ""
+	return u.String()
+}
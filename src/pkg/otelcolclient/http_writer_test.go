@@ -0,0 +1,158 @@
+package otelcolclient
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	metricsHelpers "code.cloudfoundry.org/go-metric-registry/testhelpers"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+var _ = Describe("HTTPWriter", func() {
+	var (
+		mu        sync.Mutex
+		requests  []*http.Request
+		bodies    [][]byte
+		statuses  []int
+		server    *httptest.Server
+		egressMet *metricsHelpers.SpyMetric
+		w         *HTTPWriter
+	)
+
+	BeforeEach(func() {
+		requests = nil
+		bodies = nil
+		statuses = nil
+		server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(r.Body)
+			Expect(err).ToNot(HaveOccurred())
+
+			mu.Lock()
+			defer mu.Unlock()
+			requests = append(requests, r)
+			bodies = append(bodies, body)
+			if len(statuses) > 0 {
+				rw.WriteHeader(statuses[0])
+				statuses = statuses[1:]
+			}
+		}))
+
+		u, err := url.Parse(server.URL + "/otlp/")
+		Expect(err).ToNot(HaveOccurred())
+		u.User = url.UserPassword("user", "pass")
+
+		egressMet = &metricsHelpers.SpyMetric{}
+		w = NewHTTPWriter(context.Background(), u, nil, HTTPWriterConfig{
+			MaxRetries:   2,
+			Headers:      http.Header{"X-Tenant": []string{"some-tenant"}},
+			EgressMetric: egressMet,
+		}, log.New(GinkgoWriter, "", 0))
+		w.initialRetryDelay = time.Millisecond
+	})
+
+	AfterEach(func() {
+		Expect(w.Close()).To(Succeed())
+		server.Close()
+	})
+
+	It("exports logs as protobuf", func() {
+		w.WriteLogs([]*logspb.ResourceLogs{{}, {}})
+
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].URL.Path).To(Equal("/otlp/v1/logs"))
+		Expect(requests[0].Header.Get("Content-Type")).To(Equal("application/x-protobuf"))
+		Expect(requests[0].Header.Get("X-Tenant")).To(Equal("some-tenant"))
+		user, pass, ok := requests[0].BasicAuth()
+		Expect(ok).To(BeTrue())
+		Expect(user).To(Equal("user"))
+		Expect(pass).To(Equal("pass"))
+
+		var req collogspb.ExportLogsServiceRequest
+		Expect(proto.Unmarshal(bodies[0], &req)).To(Succeed())
+		Expect(req.GetResourceLogs()).To(HaveLen(2))
+		Expect(egressMet.Value()).To(BeNumerically("==", 2))
+	})
+
+	It("retries exports the receiver is unable to handle right now", func() {
+		statuses = []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}
+
+		w.WriteMetrics([]*metricspb.Metric{{Name: "some.metric"}})
+
+		Expect(requests).To(HaveLen(3))
+		Expect(requests[2].URL.Path).To(Equal("/otlp/v1/metrics"))
+		Expect(egressMet.Value()).To(BeNumerically("==", 1))
+	})
+
+	It("drops exports the receiver rejects", func() {
+		statuses = []int{http.StatusBadRequest}
+
+		w.WriteLogs([]*logspb.ResourceLogs{{}})
+
+		Expect(requests).To(HaveLen(1))
+		Expect(egressMet.Value()).To(BeNumerically("==", 0))
+	})
+
+	It("drops exports after the maximum number of retries", func() {
+		statuses = []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway}
+
+		w.WriteLogs([]*logspb.ResourceLogs{{}})
+
+		Expect(requests).To(HaveLen(3))
+		Expect(egressMet.Value()).To(BeNumerically("==", 0))
+	})
+
+	It("reports the result of every attempt to the circuit breaker", func() {
+		cb := &spyCircuitBreaker{allow: true}
+		w.circuitBreaker = cb
+		statuses = []int{http.StatusBadGateway}
+
+		w.WriteLogs([]*logspb.ResourceLogs{{}})
+
+		Expect(requests).To(HaveLen(2))
+		Expect(cb.failures).To(Equal(1))
+		Expect(cb.successes).To(Equal(1))
+	})
+
+	It("exports batches written after its context is done with a context of its own", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		u, err := url.Parse(server.URL)
+		Expect(err).ToNot(HaveOccurred())
+		w = NewHTTPWriter(ctx, u, nil, HTTPWriterConfig{EgressMetric: egressMet}, log.New(GinkgoWriter, "", 0))
+		cancel()
+
+		w.WriteLogs([]*logspb.ResourceLogs{{}})
+
+		Expect(requests).To(HaveLen(1))
+		Expect(egressMet.Value()).To(BeNumerically("==", 1))
+	})
+
+	It("drops exports the circuit breaker refuses", func() {
+		w.circuitBreaker = &spyCircuitBreaker{}
+
+		w.WriteLogs([]*logspb.ResourceLogs{{}})
+
+		Expect(requests).To(BeEmpty())
+		Expect(egressMet.Value()).To(BeNumerically("==", 0))
+	})
+})
+
+type spyCircuitBreaker struct {
+	allow     bool
+	successes int
+	failures  int
+}
+
+func (s *spyCircuitBreaker) Allow(float64) bool { return s.allow }
+func (s *spyCircuitBreaker) Success()           { s.successes++ }
+func (s *spyCircuitBreaker) Failure()           { s.failures++ }
@@ -345,6 +345,12 @@ func (c *Client) Close() error {
 	return c.b.w.Close()
 }
 
+// FlushAndClose writes all pending batches and closes the writer.
+func (c *Client) FlushAndClose() error {
+	c.b.Stop()
+	return c.b.w.Close()
+}
+
 // writeCounter translates a loggregator v2 Counter to OTLP and adds the metric to the pending batch.
 func (c *Client) writeLog(e *loggregator_v2.Envelope) {
 	if !c.emitLogs {
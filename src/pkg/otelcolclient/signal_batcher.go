@@ -15,6 +15,8 @@ type SignalBatcher struct {
 	metricsBatcher, traceBatcher, logsBatcher *batching.Batcher
 	w                                         Writer
 	mu                                        sync.Mutex
+	done                                      chan struct{}
+	stopOnce                                  sync.Once
 }
 
 // Writer is used to submit the completed batches of OpenTelemetry signals. The
@@ -57,11 +59,18 @@ func NewSignalBatcher(size int, interval time.Duration, writer Writer) *SignalBa
 		traceBatcher:   batching.NewBatcher(size, interval, traceWriter),
 		logsBatcher:    batching.NewBatcher(size, interval, logsWriter),
 		w:              writer,
+		done:           make(chan struct{}),
 	}
 	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
 		for {
-			time.Sleep(interval)
-			sb.Flush()
+			select {
+			case <-ticker.C:
+				sb.Flush()
+			case <-sb.done:
+				return
+			}
 		}
 	}()
 	return sb
@@ -106,3 +115,17 @@ func (b *SignalBatcher) Flush() {
 	b.traceBatcher.Flush()
 	b.logsBatcher.Flush()
 }
+
+// Stop ends the periodic flushing and writes all pending batches regardless
+// of their size.
+func (b *SignalBatcher) Stop() {
+	b.stopOnce.Do(func() {
+		close(b.done)
+	})
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.metricsBatcher.ForcedFlush()
+	b.traceBatcher.ForcedFlush()
+	b.logsBatcher.ForcedFlush()
+}